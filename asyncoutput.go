@@ -0,0 +1,281 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what an asynchronous LogOutput does when its
+// buffer is full
+type OverflowPolicy int
+
+// a list of the supported overflow policies
+const (
+	// wait for the background writer to make room
+	OverflowBlock OverflowPolicy = iota
+
+	// throw away the entry that we are trying to add
+	OverflowDropNewest
+
+	// throw away the oldest entry in the buffer to make room
+	OverflowDropOldest
+
+	// throw away the entry if it is less important than
+	// AsyncOptions.DropLevel; otherwise wait for room
+	OverflowDropBelowLevel
+)
+
+// AsyncOptions configures an asynchronous LogOutput
+type AsyncOptions struct {
+	// how many entries can be waiting to be written
+	//
+	// set this to 0 to make the output synchronous again
+	BufferSize int
+
+	// what to do when the buffer is full
+	Overflow OverflowPolicy
+
+	// used by OverflowDropBelowLevel: entries at this level or more
+	// important are never dropped
+	DropLevel LogLevel
+}
+
+// asyncItem is a single entry waiting to be written
+//
+// logger is a snapshot of the Logger that sent the entry, so that our
+// formatters do not race with calls such as SetFlags()
+//
+// flush requests are also sent down the queue, so that we know when
+// everything ahead of them has been written
+type asyncItem struct {
+	logger *Logger
+	entry  *LogEntry
+	done   chan struct{}
+}
+
+// asyncQueue holds the entries waiting to be written by the background
+// goroutine of a LogOutput
+type asyncQueue struct {
+	options AsyncOptions
+	items   chan asyncItem
+
+	// held for reading while sending to items, so that stop() cannot
+	// close it underneath us
+	mu     sync.RWMutex
+	closed bool
+
+	// closed when the background goroutine has finished
+	stopped chan struct{}
+
+	// how many entries we have thrown away
+	dropped uint64
+
+	// how many entries we could not write
+	failed uint64
+}
+
+func newAsyncQueue(output *LogOutput, options AsyncOptions) *asyncQueue {
+	retval := &asyncQueue{
+		options: options,
+		items:   make(chan asyncItem, options.BufferSize),
+		stopped: make(chan struct{}),
+	}
+
+	go retval.run(output)
+	return retval
+}
+
+// run() writes entries until the queue is closed
+func (self *asyncQueue) run(output *LogOutput) {
+	defer close(self.stopped)
+
+	for item := range self.items {
+		if item.entry != nil && output.writeEntry(item.logger, item.entry) != nil {
+			atomic.AddUint64(&self.failed, 1)
+		}
+		if item.done != nil {
+			close(item.done)
+		}
+	}
+}
+
+// push() adds an entry to the queue, applying our overflow policy if the
+// queue is full
+//
+// it returns false if the queue has been stopped
+func (self *asyncQueue) push(item asyncItem) bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	if self.closed {
+		return false
+	}
+
+	// is there room?
+	select {
+	case self.items <- item:
+		return true
+	default:
+	}
+
+	// no, there is not
+	switch self.options.Overflow {
+	case OverflowDropNewest:
+		self.drop(item)
+	case OverflowDropOldest:
+		for {
+			select {
+			case self.items <- item:
+				return true
+			case oldest := <-self.items:
+				self.drop(oldest)
+			}
+		}
+	case OverflowDropBelowLevel:
+		if item.entry.LogLevel > self.options.DropLevel {
+			self.drop(item)
+		} else {
+			self.items <- item
+		}
+	default:
+		self.items <- item
+	}
+
+	return true
+}
+
+// drop() throws away an entry
+func (self *asyncQueue) drop(item asyncItem) {
+	if item.entry != nil {
+		atomic.AddUint64(&self.dropped, 1)
+	}
+
+	// never leave anyone waiting for a flush that will not happen
+	if item.done != nil {
+		close(item.done)
+	}
+}
+
+// flush() waits until everything currently in the queue has been written
+func (self *asyncQueue) flush() {
+	self.mu.RLock()
+	if self.closed {
+		self.mu.RUnlock()
+		<-self.stopped
+		return
+	}
+	done := make(chan struct{})
+	self.items <- asyncItem{done: done}
+	self.mu.RUnlock()
+
+	<-done
+}
+
+// stop() writes everything in the queue, and then stops the background
+// goroutine
+//
+// anything pushed after that is refused
+func (self *asyncQueue) stop() {
+	self.mu.Lock()
+	if !self.closed {
+		self.closed = true
+		close(self.items)
+	}
+	self.mu.Unlock()
+
+	<-self.stopped
+}
+
+// SetAsync() makes this output write entries from a background goroutine,
+// so that a slow io.Writer does not hold up the code that is logging
+//
+// entries are buffered until they can be written, and options decides
+// what happens when the buffer is full
+func (self *LogOutput) SetAsync(options AsyncOptions) *LogOutput {
+	self.queueMu.Lock()
+	defer self.queueMu.Unlock()
+
+	// write out anything still waiting in the old queue
+	if self.queue != nil {
+		self.queue.stop()
+		atomic.AddUint64(&self.dropped, atomic.LoadUint64(&self.queue.dropped))
+		atomic.AddUint64(&self.failed, atomic.LoadUint64(&self.queue.failed))
+		self.queue = nil
+	}
+
+	if options.BufferSize > 0 {
+		self.queue = newAsyncQueue(self, options)
+	}
+
+	return self
+}
+
+// IsAsync() returns true if this output writes entries from a background
+// goroutine
+func (self *LogOutput) IsAsync() bool {
+	self.queueMu.RLock()
+	defer self.queueMu.RUnlock()
+
+	return self.queue != nil
+}
+
+// DroppedEntries() returns the number of entries that this output has
+// thrown away because its buffer was full
+func (self *LogOutput) DroppedEntries() uint64 {
+	self.queueMu.RLock()
+	defer self.queueMu.RUnlock()
+
+	retval := atomic.LoadUint64(&self.dropped)
+	if self.queue != nil {
+		retval += atomic.LoadUint64(&self.queue.dropped)
+	}
+
+	return retval
+}
+
+// DroppedEntries() returns the number of entries that all of our outputs
+// have thrown away because their buffers were full
+func (self *Logger) DroppedEntries() uint64 {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	var retval uint64
+	for _, output := range self.Outputs {
+		retval += output.DroppedEntries()
+	}
+
+	return retval
+}
+
+// FailedWrites() returns the number of entries that this output's
+// background goroutine could not write, because our io.Writer returned
+// an error
+//
+// synchronous outputs return their errors to the caller instead
+func (self *LogOutput) FailedWrites() uint64 {
+	self.queueMu.RLock()
+	defer self.queueMu.RUnlock()
+
+	retval := atomic.LoadUint64(&self.failed)
+	if self.queue != nil {
+		retval += atomic.LoadUint64(&self.queue.failed)
+	}
+
+	return retval
+}
+
+// FailedWrites() returns the number of entries that the background
+// goroutines of all of our outputs could not write
+func (self *Logger) FailedWrites() uint64 {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	var retval uint64
+	for _, output := range self.Outputs {
+		retval += output.FailedWrites()
+	}
+
+	return retval
+}
@@ -0,0 +1,127 @@
+package modlog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+// blockingWriter holds up the background goroutine until we let it go
+type blockingWriter struct {
+	bytes.Buffer
+	release chan struct{}
+}
+
+func (self *blockingWriter) Write(p []byte) (int, error) {
+	<-self.release
+	return self.Buffer.Write(p)
+}
+
+func newAsyncTestLogger(out io.Writer, options AsyncOptions) *Logger {
+	l := NewLogger()
+	l.AddOutput("default", out).SetAsync(options)
+	return l
+}
+
+func TestAsyncOutputWritesInBackground(t *testing.T) {
+	var buf bytes.Buffer
+	l := newAsyncTestLogger(&buf, AsyncOptions{BufferSize: 10})
+
+	l.Info("one")
+	l.Info("two")
+	l.Flush()
+
+	assert.Equal(t, "one\ntwo\n", buf.String())
+	assert.Equal(t, uint64(0), l.DroppedEntries())
+}
+
+func TestAsyncOutputCanDropNewest(t *testing.T) {
+	out := &blockingWriter{release: make(chan struct{})}
+	l := newAsyncTestLogger(out, AsyncOptions{BufferSize: 1, Overflow: OverflowDropNewest})
+
+	// one entry is being written, one is in the buffer, and the rest
+	// have nowhere to go
+	for i := 0; i < 5; i++ {
+		l.Info(i)
+	}
+	close(out.release)
+	l.Flush()
+
+	assert.T(t, l.DroppedEntries() >= 3)
+	assert.Equal(t, "0\n", out.String()[:2])
+}
+
+func TestAsyncOutputCanDropBelowLevel(t *testing.T) {
+	out := &blockingWriter{release: make(chan struct{})}
+	l := newAsyncTestLogger(out, AsyncOptions{BufferSize: 1, Overflow: OverflowDropBelowLevel, DropLevel: WarnLevel})
+
+	for i := 0; i < 5; i++ {
+		l.Debug(i)
+	}
+	go close(out.release)
+	l.Error("important")
+	l.Flush()
+
+	assert.T(t, l.DroppedEntries() >= 3)
+	assert.Equal(t, "important\n", out.String()[len(out.String())-10:])
+}
+
+func TestAsyncOutputCountsFailedWrites(t *testing.T) {
+	l := newAsyncTestLogger(failingWriter{}, AsyncOptions{BufferSize: 10})
+
+	l.Info("one")
+	l.Info("two")
+	l.Flush()
+	assert.Equal(t, uint64(2), l.FailedWrites())
+
+	// the count survives the queue being replaced
+	l.GetOutput("default").SetAsync(AsyncOptions{})
+	assert.Equal(t, uint64(2), l.FailedWrites())
+}
+
+func TestAsyncOutputFormatsWithTheSettingsAtTheTimeOfLogging(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "before: ", 0)
+	l.GetOutput("default").SetAsync(AsyncOptions{BufferSize: 10})
+
+	// SetFlags() must not race with the background goroutine
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			l.SetFlags(0)
+		}
+	}()
+	l.Print("one")
+	<-done
+	l.SetPrefix("after: ")
+	l.Print("two")
+	l.Flush()
+
+	assert.Equal(t, "before: one\nafter: two\n", buf.String())
+}
+
+func TestAsyncOutputCanBeMadeSynchronousWhileLogging(t *testing.T) {
+	var buf bytes.Buffer
+	l := newAsyncTestLogger(&buf, AsyncOptions{BufferSize: 1})
+	output := l.GetOutput("default")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			l.Info("hello")
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		output.SetAsync(AsyncOptions{})
+		output.SetAsync(AsyncOptions{BufferSize: 1})
+	}
+	<-done
+	l.Flush()
+
+	assert.Equal(t, 100, strings.Count(buf.String(), "hello\n"))
+}
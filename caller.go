@@ -0,0 +1,119 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// the folder that our own source code lives in
+//
+// any stack frame from a (non-test) file in here belongs to us, and is
+// never reported as the caller
+var modlogDir string
+
+// the functions that have called Helper()
+var helperFuncs sync.Map
+
+// how many stack frames we look at when searching for the caller
+const maxCallerDepth = 32
+
+func init() {
+	_, file, _, ok := runtime.Caller(0)
+	if ok {
+		modlogDir = path.Dir(file)
+	}
+}
+
+// Helper() marks the calling function as a logging helper
+//
+// When working out where a log entry came from, helper functions are
+// skipped, in the same way that testing.T.Helper() works
+func Helper() {
+	var pcs [1]uintptr
+	if runtime.Callers(2, pcs[:]) == 0 {
+		return
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	helperFuncs.Store(frame.Function, true)
+}
+
+// captureCaller() works out which code is writing to the log
+//
+// we skip over all of our own code and any functions that have called
+// Helper(), and then skip a further 'skip' frames on top of that
+//
+// it returns nil if we cannot work out the caller
+func captureCaller(skip int) *LogCaller {
+	var pcs [maxCallerDepth]uintptr
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if !isInternalFrame(&frame) {
+			if skip <= 0 {
+				return newLogCaller(&frame)
+			}
+			skip--
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// callerAt() returns the caller that is 'calldepth' frames above the
+// function that calls us, using the same numbering as runtime.Caller()
+//
+// it returns nil if there is no such caller
+func callerAt(calldepth int) *LogCaller {
+	var pcs [1]uintptr
+	if runtime.Callers(calldepth+2, pcs[:]) == 0 {
+		return nil
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+
+	return newLogCaller(&frame)
+}
+
+// isInternalFrame() returns true if the frame belongs to modlog or to a
+// logging helper
+func isInternalFrame(frame *runtime.Frame) bool {
+	if _, ok := helperFuncs.Load(frame.Function); ok {
+		return true
+	}
+
+	return path.Dir(frame.File) == modlogDir && !strings.HasSuffix(frame.File, "_test.go")
+}
+
+func newLogCaller(frame *runtime.Frame) *LogCaller {
+	return &LogCaller{
+		File:     frame.File,
+		Line:     frame.Line,
+		Function: frame.Function,
+		Package:  packageOfFunction(frame.Function),
+
+		// runtime.CallersFrames() steps back into the call instruction,
+		// and will do so again when it is given this PC
+		PC: frame.PC + 1,
+	}
+}
+
+// packageOfFunction() extracts the package path from a fully-qualified
+// function name such as github.com/user/repo.(*Type).Method
+func packageOfFunction(function string) string {
+	lastSlash := strings.LastIndex(function, "/")
+	if lastSlash < 0 {
+		lastSlash = 0
+	}
+	dot := strings.Index(function[lastSlash:], ".")
+	if dot < 0 {
+		return function
+	}
+
+	return function[:lastSlash+dot]
+}
@@ -0,0 +1,52 @@
+package modlog
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func logViaHelper(l *Logger) {
+	Helper()
+	l.Info("hello")
+}
+
+func logViaWrapper(l *FieldLogger) {
+	l.Info("hello")
+}
+
+func TestCallerIsCapturedForPackageHelpers(t *testing.T) {
+	var entries []*LogEntry
+	old := defaultLogger
+	defer func() {
+		defaultLogger = old
+	}()
+	defaultLogger = newCapturingLogger(&entries)
+	_, _, line, _ := runtime.Caller(0)
+	ModInfof("test", "hello")
+
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, line+1, entries[0].Caller.Line)
+	assert.Equal(t, "github.com/stuartherbert/go_modlog", entries[0].Caller.Package)
+	assert.Equal(t, "github.com/stuartherbert/go_modlog.TestCallerIsCapturedForPackageHelpers", entries[0].Caller.Function)
+}
+
+func TestCallerSkipsHelpers(t *testing.T) {
+	var entries []*LogEntry
+	l := newCapturingLogger(&entries)
+	_, _, line, _ := runtime.Caller(0)
+	logViaHelper(l)
+
+	assert.Equal(t, line+1, entries[0].Caller.Line)
+}
+
+func TestCallerSkipsExtraFrames(t *testing.T) {
+	var entries []*LogEntry
+	l := newCapturingLogger(&entries)
+	l.SetOptions(SetCallerSkip(1))
+	_, _, line, _ := runtime.Caller(0)
+	logViaWrapper(l.WithField("a", 1))
+
+	assert.Equal(t, line+1, entries[0].Caller.Line)
+}
@@ -0,0 +1,525 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Config describes a whole Logger: its log levels, its filters, and each
+// of its outputs
+//
+// build one with LoadConfig(), or ParseConfig() and then Build()
+type Config struct {
+	// the minimum log level, e.g. "info"
+	Level string `json:"level,omitempty" yaml:"level,omitempty" toml:"level,omitempty"`
+
+	// per-module log levels, e.g. {"db": "debug", "http": "warn"}
+	Modules map[string]string `json:"modules,omitempty" yaml:"modules,omitempty" toml:"modules,omitempty"`
+
+	// filters that apply to every output
+	Filters []FilterConfig `json:"filters,omitempty" yaml:"filters,omitempty" toml:"filters,omitempty"`
+
+	// where to write to; if this is empty, the Logger keeps its default
+	// output
+	Outputs []OutputConfig `json:"outputs,omitempty" yaml:"outputs,omitempty" toml:"outputs,omitempty"`
+}
+
+// FilterConfig describes a single filter
+type FilterConfig struct {
+	// the name that the filter is registered under, e.g. "rateLimit"
+	Type string `json:"type" yaml:"type" toml:"type"`
+
+	// the name to add the filter under; defaults to Type
+	Name string `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty"`
+
+	// filters run in order of priority, lowest first, and then in the
+	// order that they appear in the document
+	Priority int `json:"priority,omitempty" yaml:"priority,omitempty" toml:"priority,omitempty"`
+
+	// passed to the filter's FilterFactory
+	Options ConfigOptions `json:"options,omitempty" yaml:"options,omitempty" toml:"options,omitempty"`
+}
+
+// OutputConfig describes a single output
+type OutputConfig struct {
+	// the name to add the output under
+	Name string `json:"name" yaml:"name" toml:"name"`
+
+	// where to write to: a registered destination, optionally followed
+	// by ':' and a target, e.g. "stderr" or "file:/var/log/app.log"
+	To string `json:"to" yaml:"to" toml:"to"`
+
+	// passed to the destination's DestinationFactory
+	ToOptions ConfigOptions `json:"toOptions,omitempty" yaml:"toOptions,omitempty" toml:"toOptions,omitempty"`
+
+	// the name of a registered writer; defaults to "syslog" or "journald"
+	// for those destinations, and to "text" for everything else
+	Writer string `json:"writer,omitempty" yaml:"writer,omitempty" toml:"writer,omitempty"`
+
+	// passed to the writer's WriterFactory
+	WriterOptions ConfigOptions `json:"writerOptions,omitempty" yaml:"writerOptions,omitempty" toml:"writerOptions,omitempty"`
+
+	// the formatters to run, by slot, e.g. {"timestamp": "stdlibDateTime"}
+	Formatters map[string]string `json:"formatters,omitempty" yaml:"formatters,omitempty" toml:"formatters,omitempty"`
+
+	// the minimum log level for this output, e.g. "warn"
+	Level string `json:"level,omitempty" yaml:"level,omitempty" toml:"level,omitempty"`
+
+	// filters that only apply to this output
+	Filters []FilterConfig `json:"filters,omitempty" yaml:"filters,omitempty" toml:"filters,omitempty"`
+
+	// if set, the output writes in the background
+	Async *AsyncConfig `json:"async,omitempty" yaml:"async,omitempty" toml:"async,omitempty"`
+}
+
+// AsyncConfig describes the AsyncOptions for an output
+type AsyncConfig struct {
+	BufferSize int `json:"bufferSize" yaml:"bufferSize" toml:"bufferSize"`
+
+	// one of "block", "dropNewest", "dropOldest" or "dropBelowLevel";
+	// defaults to "block"
+	Overflow string `json:"overflow,omitempty" yaml:"overflow,omitempty" toml:"overflow,omitempty"`
+
+	// used by "dropBelowLevel"
+	DropLevel string `json:"dropLevel,omitempty" yaml:"dropLevel,omitempty" toml:"dropLevel,omitempty"`
+}
+
+// the names that AsyncConfig.Overflow can use
+var overflowPolicyNames = map[string]OverflowPolicy{
+	"":               OverflowBlock,
+	"block":          OverflowBlock,
+	"dropNewest":     OverflowDropNewest,
+	"dropOldest":     OverflowDropOldest,
+	"dropBelowLevel": OverflowDropBelowLevel,
+}
+
+// the writers that outputs use by default for destinations that need
+// their own format
+var destinationWriters = map[string]string{
+	"syslog":   "syslog",
+	"journald": "journald",
+}
+
+// ConfigDecoder converts a document into a Config, in the same way that
+// json.Unmarshal() does
+type ConfigDecoder func(data []byte, config interface{}) error
+
+// the document formats that ParseConfig() understands
+//
+// only JSON is built in; use RegisterConfigFormat() to add others, such
+// as YAML or TOML, using the parser of your choice
+var configFormats = struct {
+	decoders map[string]ConfigDecoder
+	mu       sync.RWMutex
+}{
+	decoders: map[string]ConfigDecoder{
+		"json": decodeJSONConfig,
+	},
+}
+
+// RegisterConfigFormat() teaches ParseConfig() and LoadConfig() how to
+// read another document format, e.g.
+//
+//	modlog.RegisterConfigFormat("yaml", yaml.Unmarshal)
+//
+// LoadConfig() picks the format from the file's extension
+func RegisterConfigFormat(format string, decoder ConfigDecoder) {
+	configFormats.mu.Lock()
+	defer configFormats.mu.Unlock()
+
+	configFormats.decoders[format] = decoder
+}
+
+// LoadConfig() reads the Config document at path, checks it, and builds
+// a Logger from it
+func LoadConfig(path string) (*Logger, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if format == "yml" {
+		format = "yaml"
+	}
+
+	config, err := ParseConfig(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	logger, err := config.Build()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	return logger, nil
+}
+
+// ParseConfig() converts a document into a Config
+func ParseConfig(data []byte, format string) (*Config, error) {
+	configFormats.mu.RLock()
+	decoder, ok := configFormats.decoders[format]
+	configFormats.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported config format '%s'; use RegisterConfigFormat() to add it", format)
+	}
+
+	retval := &Config{}
+	err := decoder(data, retval)
+	if err != nil {
+		return nil, err
+	}
+
+	return retval, nil
+}
+
+// decodeJSONConfig() is the ConfigDecoder for JSON, which rejects any
+// settings that we do not know about, and anything after the document
+func decodeJSONConfig(data []byte, config interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(config)
+	if err != nil {
+		return err
+	}
+
+	_, err = decoder.Token()
+	if err != io.EOF {
+		return errors.New("json: unexpected data after the end of the document")
+	}
+
+	return nil
+}
+
+// Validate() checks that everything in the Config makes sense, and that
+// every writer, filter, formatter and destination that it names has been
+// registered
+func (self *Config) Validate() error {
+	_, err := self.logOptions()
+	if err != nil {
+		return err
+	}
+
+	for i, filter := range self.Filters {
+		err := filter.validate()
+		if err != nil {
+			return fmt.Errorf("filters[%d]: %s", i, err.Error())
+		}
+	}
+
+	seen := map[string]bool{}
+	for i, output := range self.Outputs {
+		err := output.validate()
+		if err == nil && seen[output.Name] {
+			err = fmt.Errorf("there is already an output called '%s'", output.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("outputs[%d]: %s", i, err.Error())
+		}
+		seen[output.Name] = true
+	}
+
+	return nil
+}
+
+// Build() validates the Config, and then creates a new Logger from it
+func (self *Config) Build() (*Logger, error) {
+	err := self.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	logOptions, err := self.logOptions()
+	if err != nil {
+		return nil, err
+	}
+	logger := NewLogger(logOptions...)
+
+	for i, filter := range self.Filters {
+		err := filter.addTo(logger, logger.AddFilterWithPriority)
+		if err != nil {
+			logger.Close()
+			return nil, fmt.Errorf("filters[%d]: %s", i, err.Error())
+		}
+	}
+
+	if len(self.Outputs) > 0 {
+		logger.RemoveOutput("default")
+	}
+	for i, output := range self.Outputs {
+		err := output.addTo(logger)
+		if err != nil {
+			logger.Close()
+			return nil, fmt.Errorf("outputs[%d] (%s): %s", i, output.Name, err.Error())
+		}
+	}
+
+	return logger, nil
+}
+
+// logOptions() converts our log levels into LogOptions
+func (self *Config) logOptions() ([]LogOption, error) {
+	var retval []LogOption
+
+	if len(self.Level) > 0 {
+		level, err := ParseLogLevel(self.Level)
+		if err != nil {
+			return nil, fmt.Errorf("level: %s", err.Error())
+		}
+		retval = append(retval, SetMinLogLevel(level))
+	}
+
+	if len(self.Modules) > 0 {
+		levels := ModuleLogLevels{}
+		for _, module := range sortedStringKeys(self.Modules) {
+			level, err := ParseLogLevel(self.Modules[module])
+			if err != nil {
+				return nil, fmt.Errorf("modules.%s: %s", module, err.Error())
+			}
+			levels[normaliseModuleName(module)] = level
+		}
+		retval = append(retval, SetModuleLogLevels(levels))
+	}
+
+	return retval, nil
+}
+
+func (self *FilterConfig) validate() error {
+	_, err := lookupFilter(self.Type)
+	if err != nil {
+		return err
+	}
+
+	validator := lookupFilterValidator(self.Type)
+	if validator == nil {
+		return nil
+	}
+	err = validator(self.Options)
+	if err != nil {
+		return fmt.Errorf("%s: %s", self.Type, err.Error())
+	}
+
+	return nil
+}
+
+// addTo() creates the filter, and adds it using the given function
+func (self *FilterConfig) addTo(logger *Logger, addFilter func(string, int, LogFilter)) error {
+	factory, err := lookupFilter(self.Type)
+	if err != nil {
+		return err
+	}
+	filter, err := factory(logger, self.Options)
+	if err != nil {
+		return fmt.Errorf("%s: %s", self.Type, err.Error())
+	}
+
+	name := self.Name
+	if len(name) == 0 {
+		name = self.Type
+	}
+	addFilter(name, self.Priority, filter)
+
+	return nil
+}
+
+func (self *OutputConfig) validate() error {
+	if len(self.Name) == 0 {
+		return fmt.Errorf("output has no name")
+	}
+
+	if len(self.To) == 0 {
+		return fmt.Errorf("'to' is not set")
+	}
+	destination, target := self.destination()
+	_, err := lookupDestination(destination)
+	if err != nil {
+		return err
+	}
+	validator := lookupDestinationValidator(destination)
+	if validator != nil {
+		err = validator(target, self.ToOptions)
+		if err != nil {
+			return fmt.Errorf("to %s: %s", self.To, err.Error())
+		}
+	}
+
+	// writers do not open anything, so we can create one to check its
+	// settings
+	writerFactory, err := lookupWriter(self.writerName())
+	if err != nil {
+		return err
+	}
+	_, err = writerFactory(self.WriterOptions)
+	if err != nil {
+		return fmt.Errorf("writer %s: %s", self.writerName(), err.Error())
+	}
+
+	for _, slot := range sortedStringKeys(self.Formatters) {
+		_, err := lookupFormatter(self.Formatters[slot])
+		if err != nil {
+			return fmt.Errorf("formatters.%s: %s", slot, err.Error())
+		}
+	}
+
+	if len(self.Level) > 0 {
+		_, err := ParseLogLevel(self.Level)
+		if err != nil {
+			return fmt.Errorf("level: %s", err.Error())
+		}
+	}
+
+	for i, filter := range self.Filters {
+		err := filter.validate()
+		if err != nil {
+			return fmt.Errorf("filters[%d]: %s", i, err.Error())
+		}
+	}
+
+	if self.Async != nil {
+		_, err := self.Async.asyncOptions()
+		if err != nil {
+			return fmt.Errorf("async: %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// addTo() creates the output, and adds it to the logger
+func (self *OutputConfig) addTo(logger *Logger) error {
+	// we create everything that we can before we open the destination,
+	// so that we don't leave it open if something goes wrong
+	writerFactory, err := lookupWriter(self.writerName())
+	if err != nil {
+		return err
+	}
+	writer, err := writerFactory(self.WriterOptions)
+	if err != nil {
+		return fmt.Errorf("writer %s: %s", self.writerName(), err.Error())
+	}
+
+	formatters := make(map[string]LogFormatter, len(self.Formatters))
+	for slot, name := range self.Formatters {
+		formatters[slot], err = lookupFormatter(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	destination, target := self.destination()
+	destinationFactory, err := lookupDestination(destination)
+	if err != nil {
+		return err
+	}
+	out, err := destinationFactory(target, self.ToOptions)
+	if err != nil {
+		return fmt.Errorf("to %s: %s", self.To, err.Error())
+	}
+
+	output := logger.AddOutput(self.Name, out).SetCheckedWriter(writer)
+	for _, slot := range sortedFormatterSlots(formatters) {
+		output.AddFormatter(slot, formatters[slot])
+	}
+
+	if len(self.Level) > 0 {
+		level, err := ParseLogLevel(self.Level)
+		if err != nil {
+			return err
+		}
+		err = output.Options.SetOption("minLogLevel", level)
+		if err != nil {
+			return err
+		}
+		output.AddFilterWithPriority(LogLevelFilter, PriorityFirst, FilterLogToMinLevel)
+	}
+
+	for i, filter := range self.Filters {
+		err := filter.addTo(logger, func(name string, priority int, filter LogFilter) {
+			output.AddFilterWithPriority(name, priority, filter)
+		})
+		if err != nil {
+			return fmt.Errorf("filters[%d]: %s", i, err.Error())
+		}
+	}
+
+	if self.Async != nil {
+		asyncOptions, err := self.Async.asyncOptions()
+		if err != nil {
+			return err
+		}
+		output.SetAsync(asyncOptions)
+	}
+
+	return nil
+}
+
+// destination() splits 'to' into the destination's name and its target
+func (self *OutputConfig) destination() (string, string) {
+	parts := strings.SplitN(self.To, ":", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// writerName() returns the name of the writer to use; by default, this
+// is the writer that matches our destination, or 'text'
+func (self *OutputConfig) writerName() string {
+	if len(self.Writer) > 0 {
+		return self.Writer
+	}
+
+	destination, _ := self.destination()
+	if writer, ok := destinationWriters[destination]; ok {
+		return writer
+	}
+
+	return "text"
+}
+
+func (self *AsyncConfig) asyncOptions() (AsyncOptions, error) {
+	var retval AsyncOptions
+
+	if self.BufferSize <= 0 {
+		return retval, fmt.Errorf("bufferSize must be greater than 0")
+	}
+	retval.BufferSize = self.BufferSize
+
+	overflow, ok := overflowPolicyNames[self.Overflow]
+	if !ok {
+		return retval, fmt.Errorf("unknown overflow '%s'; expected block, dropNewest, dropOldest or dropBelowLevel", self.Overflow)
+	}
+	retval.Overflow = overflow
+
+	if len(self.DropLevel) > 0 {
+		level, err := ParseLogLevel(self.DropLevel)
+		if err != nil {
+			return retval, fmt.Errorf("dropLevel: %s", err.Error())
+		}
+		retval.DropLevel = level
+	}
+
+	return retval, nil
+}
+
+func sortedFormatterSlots(formatters map[string]LogFormatter) []string {
+	retval := make([]string, 0, len(formatters))
+	for slot := range formatters {
+		retval = append(retval, slot)
+	}
+	sort.Strings(retval)
+
+	return retval
+}
@@ -0,0 +1,156 @@
+package modlog
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+	"github.com/stuartherbert/go_options"
+)
+
+func TestLoadConfigBuildsLogger(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	configPath := filepath.Join(dir, "modlog.json")
+	document := `{
+		"level": "debug",
+		"modules": {"db": "warn"},
+		"outputs": [
+			{
+				"name": "file",
+				"to": "file:` + logPath + `",
+				"writer": "logfmt",
+				"writerOptions": {"timeKey": ""},
+				"filters": [{"type": "noSecrets"}]
+			},
+			{
+				"name": "errors",
+				"to": "stderr",
+				"level": "error",
+				"formatters": {"loglevel": "shortLogLevel"}
+			}
+		]
+	}`
+	assert.Equal(t, nil, os.WriteFile(configPath, []byte(document), 0644))
+
+	RegisterFilter("noSecrets", func(logger *Logger, settings ConfigOptions) (LogFilter, error) {
+		return func(store *options.OptionsStore, entry *LogEntry) bool {
+			return !strings.Contains(entry.Message, "password")
+		}, nil
+	})
+	t.Cleanup(func() { unregisterFilter("noSecrets") })
+
+	logger, err := LoadConfig(configPath)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"file", "errors"}, logger.OutputNames())
+	assert.Equal(t, []string{"noSecrets"}, logger.GetOutput("file").FilterNames())
+	assert.Equal(t, []string{LogLevelFilter}, logger.GetOutput("errors").FilterNames())
+
+	logger.Debug("starting")
+	logger.Module("db").Info("connected")
+	logger.Info("password is hunter2")
+	logger.Close()
+
+	contents, err := os.ReadFile(logPath)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "level=debug msg=starting\n", string(contents))
+}
+
+func TestConfigValidateReportsProblems(t *testing.T) {
+	tests := map[string]string{
+		`{"level": "loud"}`: "level: unknown log level 'loud'",
+		`{"outputs": [{"name": "a", "to": "stderr", "writer": "xml"}]}`:                                                  "outputs[0]: unknown writer 'xml'; expected one of: console, journald, json, logfmt, stdlib, syslog, template, text",
+		`{"outputs": [{"name": "a", "to": "kafka:logs"}]}`:                                                               "outputs[0]: unknown destination 'kafka'; expected one of: file, journald, rotating, stderr, stdout, syslog",
+		`{"outputs": [{"name": "a", "to": "stderr"}, {"name": "a", "to": "stdout"}]}`:                                    "outputs[1]: there is already an output called 'a'",
+		`{"outputs": [{"name": "a", "to": "stderr", "async": {"bufferSize": 0}}]}`:                                       "outputs[0]: async: bufferSize must be greater than 0",
+		`{"outputs": [{"name": "a", "to": "stderr", "formatters": {"timestamp": "x"}}]}`:                                 "outputs[0]: formatters.timestamp: unknown formatter 'x'; expected one of: shortLogLevel, standardLogLevel, stdlibDateTime, stdlibFile, stdlibPrefix",
+		`{"outputs": [{"name": "a", "to": "stderr", "writer": "json", "writerOptions": {"timeKey": 1}}]}`:                "outputs[0]: writer json: option 'timeKey': expected a string",
+		`{"outputs": [{"name": "a", "to": "stderr", "writer": "template", "writerOptions": {"pattern": "{{.Message"}}]}`: "outputs[0]: writer template: template: modlog:1: unclosed action",
+		`{"outputs": [{"name": "a", "to": "rotating:/tmp/app.log", "toOptions": {"maxSize": "big"}}]}`:                   "outputs[0]: to rotating:/tmp/app.log: option 'maxSize': expected a whole number",
+		`{"outputs": [{"name": "a", "to": "file:"}]}`:                                                                    "outputs[0]: to file:: no path given; expected file:/path",
+		`{"filters": [{"type": "rateLimit", "options": {"every": "soon"}}]}`:                                             `filters[0]: rateLimit: option 'every': time: invalid duration "soon"`,
+		`{"outputs": [{"name": "a", "to": "stderr", "filters": [{"type": "sample", "options": {"rate": "half"}}]}]}`:     "outputs[0]: filters[0]: sample: option 'rate': expected a number",
+		`{"outputs": [{"name": "a", "to": "stderr", "filters": [{"type": "sample"}]}]}`:                                  "outputs[0]: filters[0]: sample: the rule keeps nothing; set First, Thereafter or Rate",
+		`{"outputs": [{"name": "a", "to": "syslog:127.0.0.1"}]}`:                                                         "outputs[0]: to syslog:127.0.0.1: address 127.0.0.1: missing port in address",
+		`{"outputs": [{"name": "a", "to": "syslog:127.0.0.1:514", "toOptions": {"network": "sctp"}}]}`:                   "outputs[0]: to syslog:127.0.0.1:514: unsupported syslog network 'sctp'",
+		`{"outputs": [{"name": "a", "to": "syslog", "toOptions": {"network": "tcp"}}]}`:                                  "outputs[0]: to syslog: syslog network 'tcp' needs an address",
+	}
+
+	for document, expected := range tests {
+		config, err := ParseConfig([]byte(document), "json")
+		assert.Equal(t, nil, err)
+		err = config.Validate()
+		assert.Equal(t, expected, err.Error())
+	}
+
+	_, err := ParseConfig([]byte(`{"outputz": []}`), "json")
+	assert.Equal(t, `json: unknown field "outputz"`, err.Error())
+
+	_, err = ParseConfig([]byte(`{"level": "info"} {"level": "debug"}`), "json")
+	assert.Equal(t, "json: unexpected data after the end of the document", err.Error())
+
+	_, err = ParseConfig([]byte(`level: info`), "yaml")
+	assert.Equal(t, "unsupported config format 'yaml'; use RegisterConfigFormat() to add it", err.Error())
+}
+
+func TestConfigBuildStopsRateLimitersWhenItFails(t *testing.T) {
+	document := `{
+		"filters": [{"type": "rateLimit"}],
+		"outputs": [{"name": "a", "to": "file:` + filepath.Join(t.TempDir(), "missing", "app.log") + `"}]
+	}`
+	config, err := ParseConfig([]byte(document), "json")
+	assert.Equal(t, nil, err)
+
+	before := runtime.NumGoroutine()
+	_, err = config.Build()
+	assert.NotEqual(t, nil, err)
+
+	// the rate limiter's goroutine has gone
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, before, runtime.NumGoroutine())
+}
+
+func TestConfigBuildsASyslogOutputFromAnAddress(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	defer server.Close()
+
+	config, err := ParseConfig([]byte(`{"outputs": [{"name": "a", "to": "syslog:`+server.LocalAddr().String()+`"}]}`), "json")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, config.Validate())
+
+	logger, err := config.Build()
+	assert.Equal(t, nil, err)
+	logger.Info("hello")
+	defer logger.Close()
+
+	buf := make([]byte, 1024)
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := server.ReadFrom(buf)
+	assert.Equal(t, nil, err)
+	assert.T(t, strings.HasSuffix(string(buf[:n]), " hello"), string(buf[:n]))
+}
+
+func TestOutputConfigPicksAWriterThatMatchesItsDestination(t *testing.T) {
+	tests := []struct {
+		output   OutputConfig
+		expected string
+	}{
+		{OutputConfig{To: "stderr"}, "text"},
+		{OutputConfig{To: "file:/var/log/app.log"}, "text"},
+		{OutputConfig{To: "syslog:localhost:514"}, "syslog"},
+		{OutputConfig{To: "journald"}, "journald"},
+		{OutputConfig{To: "syslog", Writer: "json"}, "json"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.output.writerName(), test.output.To)
+	}
+}
@@ -0,0 +1,766 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigOptions holds the settings for a writer, filter or destination in
+// a Config document
+type ConfigOptions map[string]interface{}
+
+// WriterFactory creates a CheckedOutputWriter from its settings in a Config
+//
+// Config.Validate() calls it too, to check the settings, so it must not
+// open or start anything
+type WriterFactory func(options ConfigOptions) (CheckedOutputWriter, error)
+
+// FilterFactory creates a LogFilter from its settings in a Config
+//
+// logger is the Logger that is being built, for filters (such as the
+// rate limiter) that need to log entries of their own
+type FilterFactory func(logger *Logger, options ConfigOptions) (LogFilter, error)
+
+// FilterValidator checks a filter's settings in a Config, without
+// creating the filter
+type FilterValidator func(options ConfigOptions) error
+
+// DestinationFactory opens the io.Writer that an output writes to
+//
+// target is whatever follows the ':' in the output's 'to' setting, e.g.
+// '/var/log/app.log' for 'file:/var/log/app.log'
+type DestinationFactory func(target string, options ConfigOptions) (io.Writer, error)
+
+// DestinationValidator checks a destination's settings in a Config,
+// without opening it
+type DestinationValidator func(target string, options ConfigOptions) error
+
+// the things that a Config document can refer to by name
+var configRegistry = struct {
+	writers      map[string]WriterFactory
+	filters      map[string]FilterFactory
+	formatters   map[string]LogFormatter
+	destinations map[string]DestinationFactory
+
+	// optional; used by Config.Validate()
+	filterValidators      map[string]FilterValidator
+	destinationValidators map[string]DestinationValidator
+
+	mu sync.RWMutex
+}{
+	writers: map[string]WriterFactory{
+		"text":     newTextWriterFromConfig,
+		"stdlib":   newStdlibWriterFromConfig,
+		"json":     newJSONWriterFromConfig,
+		"logfmt":   newLogfmtWriterFromConfig,
+		"console":  newConsoleWriterFromConfig,
+		"template": newTemplateWriterFromConfig,
+		"syslog":   newSyslogWriterFromConfig,
+		"journald": newJournaldWriterFromConfig,
+	},
+	filters: map[string]FilterFactory{
+		"rateLimit": newRateLimitFilterFromConfig,
+		"sample":    newSampleFilterFromConfig,
+	},
+	formatters: map[string]LogFormatter{
+		"stdlibDateTime":   StdlibDateTimeFormatter,
+		"standardLogLevel": StandardLogLevelFormatter,
+		"shortLogLevel":    ShortLogLevelFormatter,
+		"stdlibPrefix":     StdlibPrefixFormatter,
+		"stdlibFile":       StdlibFileFormatter,
+	},
+	destinations: map[string]DestinationFactory{
+		"stderr":   openStderrFromConfig,
+		"stdout":   openStdoutFromConfig,
+		"file":     openFileFromConfig,
+		"rotating": openRotatingFileFromConfig,
+		"syslog":   openSyslogFromConfig,
+		"journald": openJournaldFromConfig,
+	},
+	filterValidators: map[string]FilterValidator{
+		"rateLimit": validateRateLimitConfig,
+		"sample":    validateSampleConfig,
+	},
+	destinationValidators: map[string]DestinationValidator{
+		"file":     validateFileConfig,
+		"rotating": validateRotatingFileConfig,
+		"syslog":   validateSyslogConfig,
+	},
+}
+
+// RegisterWriter() makes a writer available to Config documents under
+// the given name, replacing any writer already registered under it
+func RegisterWriter(name string, factory WriterFactory) {
+	configRegistry.mu.Lock()
+	defer configRegistry.mu.Unlock()
+
+	configRegistry.writers[name] = factory
+}
+
+// RegisterFilter() makes a filter available to Config documents under
+// the given name, replacing any filter (and its FilterValidator) already
+// registered under it
+func RegisterFilter(name string, factory FilterFactory) {
+	configRegistry.mu.Lock()
+	defer configRegistry.mu.Unlock()
+
+	configRegistry.filters[name] = factory
+	delete(configRegistry.filterValidators, name)
+}
+
+// unregisterFilter() removes the named filter and its FilterValidator,
+// so that tests can tidy up after themselves
+func unregisterFilter(name string) {
+	configRegistry.mu.Lock()
+	defer configRegistry.mu.Unlock()
+
+	delete(configRegistry.filters, name)
+	delete(configRegistry.filterValidators, name)
+}
+
+// RegisterFilterValidator() tells Config.Validate() how to check the
+// settings for the named filter
+//
+// without one, the filter's settings are only checked by Build()
+func RegisterFilterValidator(name string, validator FilterValidator) {
+	configRegistry.mu.Lock()
+	defer configRegistry.mu.Unlock()
+
+	configRegistry.filterValidators[name] = validator
+}
+
+// RegisterFormatter() makes a formatter available to Config documents
+// under the given name, replacing any formatter already registered under
+// it
+func RegisterFormatter(name string, formatter LogFormatter) {
+	configRegistry.mu.Lock()
+	defer configRegistry.mu.Unlock()
+
+	configRegistry.formatters[name] = formatter
+}
+
+// RegisterDestination() makes a destination available to Config documents
+// under the given name, replacing any destination (and its
+// DestinationValidator) already registered under it
+func RegisterDestination(name string, factory DestinationFactory) {
+	configRegistry.mu.Lock()
+	defer configRegistry.mu.Unlock()
+
+	configRegistry.destinations[name] = factory
+	delete(configRegistry.destinationValidators, name)
+}
+
+// RegisterDestinationValidator() tells Config.Validate() how to check the
+// settings for the named destination
+//
+// without one, the destination's settings are only checked by Build()
+func RegisterDestinationValidator(name string, validator DestinationValidator) {
+	configRegistry.mu.Lock()
+	defer configRegistry.mu.Unlock()
+
+	configRegistry.destinationValidators[name] = validator
+}
+
+func lookupWriter(name string) (WriterFactory, error) {
+	configRegistry.mu.RLock()
+	defer configRegistry.mu.RUnlock()
+
+	factory, ok := configRegistry.writers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown writer '%s'; expected one of: %s", name, registryNames(configRegistry.writers))
+	}
+	return factory, nil
+}
+
+func lookupFilter(name string) (FilterFactory, error) {
+	configRegistry.mu.RLock()
+	defer configRegistry.mu.RUnlock()
+
+	factory, ok := configRegistry.filters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown filter '%s'; expected one of: %s", name, registryNames(configRegistry.filters))
+	}
+	return factory, nil
+}
+
+// lookupFilterValidator() returns nil if the filter has no validator
+func lookupFilterValidator(name string) FilterValidator {
+	configRegistry.mu.RLock()
+	defer configRegistry.mu.RUnlock()
+
+	return configRegistry.filterValidators[name]
+}
+
+func lookupFormatter(name string) (LogFormatter, error) {
+	configRegistry.mu.RLock()
+	defer configRegistry.mu.RUnlock()
+
+	formatter, ok := configRegistry.formatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown formatter '%s'; expected one of: %s", name, registryNames(configRegistry.formatters))
+	}
+	return formatter, nil
+}
+
+func lookupDestination(name string) (DestinationFactory, error) {
+	configRegistry.mu.RLock()
+	defer configRegistry.mu.RUnlock()
+
+	factory, ok := configRegistry.destinations[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown destination '%s'; expected one of: %s", name, registryNames(configRegistry.destinations))
+	}
+	return factory, nil
+}
+
+// lookupDestinationValidator() returns nil if the destination has no
+// validator
+func lookupDestinationValidator(name string) DestinationValidator {
+	configRegistry.mu.RLock()
+	defer configRegistry.mu.RUnlock()
+
+	return configRegistry.destinationValidators[name]
+}
+
+// registryNames() returns the sorted keys of one of our registries, for
+// error messages
+func registryNames(registry interface{}) string {
+	var names []string
+	switch typed := registry.(type) {
+	case map[string]WriterFactory:
+		for name := range typed {
+			names = append(names, name)
+		}
+	case map[string]FilterFactory:
+		for name := range typed {
+			names = append(names, name)
+		}
+	case map[string]LogFormatter:
+		for name := range typed {
+			names = append(names, name)
+		}
+	case map[string]DestinationFactory:
+		for name := range typed {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// String() returns the named option, or def if it is not set
+func (self ConfigOptions) String(name string, def string) (string, error) {
+	value, ok := self[name]
+	if !ok || value == nil {
+		return def, nil
+	}
+	retval, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("option '%s': expected a string", name)
+	}
+
+	return retval, nil
+}
+
+// Int() returns the named option, or def if it is not set
+func (self ConfigOptions) Int(name string, def int) (int, error) {
+	value, ok := self[name]
+	if !ok || value == nil {
+		return def, nil
+	}
+
+	switch typed := value.(type) {
+	case int:
+		return typed, nil
+	case int64:
+		return int(typed), nil
+	case float64:
+		// encoding/json gives us all numbers as float64
+		if typed == float64(int(typed)) {
+			return int(typed), nil
+		}
+	}
+
+	return 0, fmt.Errorf("option '%s': expected a whole number", name)
+}
+
+// Float() returns the named option, or def if it is not set
+func (self ConfigOptions) Float(name string, def float64) (float64, error) {
+	value, ok := self[name]
+	if !ok || value == nil {
+		return def, nil
+	}
+
+	switch typed := value.(type) {
+	case float64:
+		return typed, nil
+	case int:
+		return float64(typed), nil
+	case int64:
+		return float64(typed), nil
+	}
+
+	return 0, fmt.Errorf("option '%s': expected a number", name)
+}
+
+// Bool() returns the named option, or def if it is not set
+func (self ConfigOptions) Bool(name string, def bool) (bool, error) {
+	value, ok := self[name]
+	if !ok || value == nil {
+		return def, nil
+	}
+	retval, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("option '%s': expected true or false", name)
+	}
+
+	return retval, nil
+}
+
+// Duration() returns the named option, or def if it is not set
+//
+// durations are written the way that time.ParseDuration() expects,
+// e.g. "1m30s"
+func (self ConfigOptions) Duration(name string, def time.Duration) (time.Duration, error) {
+	value, err := self.String(name, "")
+	if err != nil {
+		return 0, fmt.Errorf("option '%s': expected a duration such as \"30s\"", name)
+	}
+	if len(value) == 0 {
+		return def, nil
+	}
+	retval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("option '%s': %s", name, err.Error())
+	}
+
+	return retval, nil
+}
+
+// LogLevel() returns the named option, or def if it is not set
+func (self ConfigOptions) LogLevel(name string, def LogLevel) (LogLevel, error) {
+	value, err := self.String(name, "")
+	if err != nil {
+		return 0, err
+	}
+	if len(value) == 0 {
+		return def, nil
+	}
+	retval, err := ParseLogLevel(value)
+	if err != nil {
+		return 0, fmt.Errorf("option '%s': %s", name, err.Error())
+	}
+
+	return retval, nil
+}
+
+// entryKeyFunc() converts an option such as "callsite", "message" or
+// "field:requestId" into an EntryKeyFunc
+func (self ConfigOptions) entryKeyFunc(name string) (EntryKeyFunc, error) {
+	value, err := self.String(name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(value) == 0:
+		return nil, nil
+	case value == "callsite":
+		return KeyByCallSite, nil
+	case value == "message":
+		return KeyByMessage, nil
+	case strings.HasPrefix(value, "field:") && len(value) > len("field:"):
+		return KeyByField(strings.TrimPrefix(value, "field:")), nil
+	}
+
+	return nil, fmt.Errorf("option '%s': unknown key '%s'; expected callsite, message or field:<name>", name, value)
+}
+
+// the built-in writers that Config documents can use
+
+func newTextWriterFromConfig(options ConfigOptions) (CheckedOutputWriter, error) {
+	return DefaultCheckedOutputWriter, nil
+}
+
+func newStdlibWriterFromConfig(options ConfigOptions) (CheckedOutputWriter, error) {
+	return StdlibCheckedOutputWriter, nil
+}
+
+func newJSONWriterFromConfig(options ConfigOptions) (CheckedOutputWriter, error) {
+	config := DefaultJSONWriterConfig
+
+	var err error
+	config.TimeKey, err = options.String("timeKey", config.TimeKey)
+	if err != nil {
+		return nil, err
+	}
+	config.TimeFormat, err = options.String("timeFormat", config.TimeFormat)
+	if err != nil {
+		return nil, err
+	}
+	config.FieldsKey, err = options.String("fieldsKey", config.FieldsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewJSONOutputWriter(config), nil
+}
+
+func newLogfmtWriterFromConfig(options ConfigOptions) (CheckedOutputWriter, error) {
+	config := DefaultLogfmtWriterConfig
+
+	var err error
+	config.TimeKey, err = options.String("timeKey", config.TimeKey)
+	if err != nil {
+		return nil, err
+	}
+	config.TimeFormat, err = options.String("timeFormat", config.TimeFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLogfmtOutputWriter(config), nil
+}
+
+func newConsoleWriterFromConfig(options ConfigOptions) (CheckedOutputWriter, error) {
+	config := DefaultConsoleWriterConfig
+
+	colour, err := options.String("colour", "auto")
+	if err != nil {
+		return nil, err
+	}
+	switch colour {
+	case "auto":
+		config.Colour = ColourAuto
+	case "always":
+		config.Colour = ColourAlways
+	case "never":
+		config.Colour = ColourNever
+	default:
+		return nil, fmt.Errorf("option 'colour': unknown value '%s'; expected auto, always or never", colour)
+	}
+
+	config.ColourModules, err = options.Bool("colourModules", config.ColourModules)
+	if err != nil {
+		return nil, err
+	}
+	config.TimeFormat, err = options.String("timeFormat", config.TimeFormat)
+	if err != nil {
+		return nil, err
+	}
+	config.ModuleWidth, err = options.Int("moduleWidth", config.ModuleWidth)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConsoleOutputWriter(config), nil
+}
+
+func newTemplateWriterFromConfig(options ConfigOptions) (CheckedOutputWriter, error) {
+	pattern, err := options.String("pattern", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTemplateOutputWriter(pattern)
+}
+
+// the names that a Config document can use for syslog facilities
+var syslogFacilityNames = map[string]SyslogFacility{
+	"kern":     LogKern,
+	"user":     LogUser,
+	"mail":     LogMail,
+	"daemon":   LogDaemon,
+	"auth":     LogAuth,
+	"syslog":   LogSyslog,
+	"lpr":      LogLpr,
+	"news":     LogNews,
+	"uucp":     LogUucp,
+	"cron":     LogCron,
+	"authpriv": LogAuthpriv,
+	"ftp":      LogFtp,
+	"local0":   LogLocal0,
+	"local1":   LogLocal1,
+	"local2":   LogLocal2,
+	"local3":   LogLocal3,
+	"local4":   LogLocal4,
+	"local5":   LogLocal5,
+	"local6":   LogLocal6,
+	"local7":   LogLocal7,
+}
+
+func newSyslogWriterFromConfig(options ConfigOptions) (CheckedOutputWriter, error) {
+	var config SyslogConfig
+
+	facility, err := options.String("facility", "user")
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	config.Facility, ok = syslogFacilityNames[facility]
+	if !ok {
+		return nil, fmt.Errorf("option 'facility': unknown facility '%s'", facility)
+	}
+
+	format, err := options.String("format", "rfc5424")
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "rfc5424":
+		config.Format = SyslogRFC5424
+	case "rfc3164":
+		config.Format = SyslogRFC3164
+	default:
+		return nil, fmt.Errorf("option 'format': unknown format '%s'; expected rfc5424 or rfc3164", format)
+	}
+
+	config.Hostname, err = options.String("hostname", "")
+	if err != nil {
+		return nil, err
+	}
+	config.AppName, err = options.String("appName", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSyslogOutputWriter(config), nil
+}
+
+func newJournaldWriterFromConfig(options ConfigOptions) (CheckedOutputWriter, error) {
+	identifier, err := options.String("identifier", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return NewJournaldOutputWriter(JournaldConfig{Identifier: identifier}), nil
+}
+
+// the built-in filters that Config documents can use
+
+func newRateLimitFilterFromConfig(logger *Logger, options ConfigOptions) (LogFilter, error) {
+	rateLimitOptions, err := rateLimitOptionsFromConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRateLimiter(logger, rateLimitOptions).Filter, nil
+}
+
+func validateRateLimitConfig(options ConfigOptions) error {
+	_, err := rateLimitOptionsFromConfig(options)
+	return err
+}
+
+func rateLimitOptionsFromConfig(options ConfigOptions) (RateLimitOptions, error) {
+	var retval RateLimitOptions
+
+	var err error
+	retval.Key, err = options.entryKeyFunc("key")
+	if err != nil {
+		return retval, err
+	}
+	retval.Burst, err = options.Int("burst", 0)
+	if err != nil {
+		return retval, err
+	}
+	retval.Every, err = options.Duration("every", 0)
+	if err != nil {
+		return retval, err
+	}
+	retval.SummaryInterval, err = options.Duration("summaryInterval", 0)
+	if err != nil {
+		return retval, err
+	}
+
+	return retval, nil
+}
+
+func newSampleFilterFromConfig(logger *Logger, options ConfigOptions) (LogFilter, error) {
+	rule, err := samplingRuleFromConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	sampler, err := NewSampler(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	return sampler.Filter, nil
+}
+
+func validateSampleConfig(options ConfigOptions) error {
+	_, err := samplingRuleFromConfig(options)
+	return err
+}
+
+func samplingRuleFromConfig(options ConfigOptions) (SamplingRule, error) {
+	var rule SamplingRule
+
+	var err error
+	rule.Module, err = options.String("module", "")
+	if err != nil {
+		return rule, err
+	}
+	rule.Level, err = options.LogLevel("level", DebugLevel)
+	if err != nil {
+		return rule, err
+	}
+	rule.First, err = options.Int("first", 0)
+	if err != nil {
+		return rule, err
+	}
+	rule.Thereafter, err = options.Int("thereafter", 0)
+	if err != nil {
+		return rule, err
+	}
+	rule.Interval, err = options.Duration("interval", 0)
+	if err != nil {
+		return rule, err
+	}
+	rule.Key, err = options.entryKeyFunc("key")
+	if err != nil {
+		return rule, err
+	}
+	rule.Rate, err = options.Float("rate", 0)
+	if err != nil {
+		return rule, err
+	}
+	rule.HashKey, err = options.entryKeyFunc("hashKey")
+	if err != nil {
+		return rule, err
+	}
+
+	return rule, rule.validate()
+}
+
+// the built-in destinations that Config documents can use
+
+func openStderrFromConfig(target string, options ConfigOptions) (io.Writer, error) {
+	return os.Stderr, nil
+}
+
+func openStdoutFromConfig(target string, options ConfigOptions) (io.Writer, error) {
+	return os.Stdout, nil
+}
+
+func openFileFromConfig(target string, options ConfigOptions) (io.Writer, error) {
+	reopenOptions, err := reopenOptionsFromConfig(target, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenReopenableFile(target, reopenOptions)
+}
+
+func validateFileConfig(target string, options ConfigOptions) error {
+	_, err := reopenOptionsFromConfig(target, options)
+	return err
+}
+
+func reopenOptionsFromConfig(target string, options ConfigOptions) (ReopenOptions, error) {
+	var retval ReopenOptions
+	if len(target) == 0 {
+		return retval, fmt.Errorf("no path given; expected file:/path")
+	}
+
+	var err error
+	retval.CheckInterval, err = options.Duration("checkInterval", 0)
+	if err != nil {
+		return retval, err
+	}
+
+	return retval, nil
+}
+
+func openRotatingFileFromConfig(target string, options ConfigOptions) (io.Writer, error) {
+	rotateOptions, err := rotateOptionsFromConfig(target, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenRotatingFile(target, rotateOptions)
+}
+
+func validateRotatingFileConfig(target string, options ConfigOptions) error {
+	_, err := rotateOptionsFromConfig(target, options)
+	return err
+}
+
+func rotateOptionsFromConfig(target string, options ConfigOptions) (RotateOptions, error) {
+	var rotateOptions RotateOptions
+	if len(target) == 0 {
+		return rotateOptions, fmt.Errorf("no path given; expected rotating:/path")
+	}
+
+	maxSize, err := options.Int("maxSize", 0)
+	if err != nil {
+		return rotateOptions, err
+	}
+	rotateOptions.MaxSize = int64(maxSize)
+	rotateOptions.Interval, err = options.Duration("interval", 0)
+	if err != nil {
+		return rotateOptions, err
+	}
+	rotateOptions.MaxBackups, err = options.Int("maxBackups", 0)
+	if err != nil {
+		return rotateOptions, err
+	}
+	rotateOptions.MaxAge, err = options.Duration("maxAge", 0)
+	if err != nil {
+		return rotateOptions, err
+	}
+	rotateOptions.Compress, err = options.Bool("compress", false)
+	if err != nil {
+		return rotateOptions, err
+	}
+
+	return rotateOptions, nil
+}
+
+func openSyslogFromConfig(target string, options ConfigOptions) (io.Writer, error) {
+	dialOptions, err := syslogDialOptionsFromConfig(target, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return DialSyslog(dialOptions)
+}
+
+func validateSyslogConfig(target string, options ConfigOptions) error {
+	dialOptions, err := syslogDialOptionsFromConfig(target, options)
+	if err != nil {
+		return err
+	}
+
+	return dialOptions.validate()
+}
+
+func syslogDialOptionsFromConfig(target string, options ConfigOptions) (SyslogDialOptions, error) {
+	var retval SyslogDialOptions
+
+	var err error
+	retval.Network, err = options.String("network", "")
+	if err != nil {
+		return retval, err
+	}
+	retval.Address = target
+	retval.Timeout, err = options.Duration("timeout", 0)
+	if err != nil {
+		return retval, err
+	}
+
+	return retval, nil
+}
+
+func openJournaldFromConfig(target string, options ConfigOptions) (io.Writer, error) {
+	return DialJournald(target)
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+)
+
+// ColourMode decides when the console writer uses ANSI colours
+type ColourMode int
+
+// a list of the supported colour modes
+const (
+	// use colour if we are writing to a terminal, and neither NO_COLOR
+	// nor TERM=dumb is set in the environment
+	ColourAuto ColourMode = iota
+
+	// always use colour
+	ColourAlways
+
+	// never use colour
+	ColourNever
+)
+
+// ConsoleWriterConfig controls the output of the writer that
+// NewConsoleOutputWriter() creates
+type ConsoleWriterConfig struct {
+	// when to use colour
+	Colour ColourMode
+
+	// set this to give each module its own colour
+	ColourModules bool
+
+	// the layout to pass to time.Format(); this is ignored if the output
+	// has a timestamp formatter
+	TimeFormat string
+
+	// pad module names to at least this many characters, so that the
+	// messages line up
+	ModuleWidth int
+}
+
+// DefaultConsoleWriterConfig is the config used by ConsoleOutputWriter()
+var DefaultConsoleWriterConfig = ConsoleWriterConfig{
+	Colour:        ColourAuto,
+	ColourModules: true,
+	TimeFormat:    "15:04:05.000",
+	ModuleWidth:   12,
+}
+
+// the ANSI escape sequences that we use
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiFaint  = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiBlue   = "\x1b[34m"
+	ansiCyan   = "\x1b[36m"
+	ansiGrey   = "\x1b[90m"
+	ansiBgRed  = "\x1b[41m\x1b[97m"
+)
+
+// LogLevelColours holds the ANSI colour used for each log level
+var LogLevelColours = map[LogLevel]string{
+	EmergencyLevel: ansiBgRed + ansiBold,
+	AlertLevel:     ansiBgRed,
+	CriticalLevel:  ansiRed + ansiBold,
+	ErrorLevel:     ansiRed,
+	WarnLevel:      ansiYellow,
+	NoticeLevel:    ansiCyan,
+	InfoLevel:      ansiGreen,
+	DebugLevel:     ansiBlue,
+	TraceLevel:     ansiGrey,
+}
+
+// the colours that module names can be given
+var moduleColours = []string{
+	"\x1b[35m",
+	"\x1b[36m",
+	"\x1b[33m",
+	"\x1b[32m",
+	"\x1b[34m",
+	"\x1b[95m",
+	"\x1b[96m",
+	"\x1b[93m",
+}
+
+// the width of the longest name in LogLevelNames
+const logLevelNameWidth = 9
+
+// ConsoleOutputWriter() writes each log entry as an aligned, colourised
+// line for humans to read, using DefaultConsoleWriterConfig
+func ConsoleOutputWriter(out io.Writer, entry *LogEntry, data map[string]string) error {
+	return defaultConsoleWriter(out, entry, data)
+}
+
+var defaultConsoleWriter = NewConsoleOutputWriter(DefaultConsoleWriterConfig)
+
+// NewConsoleOutputWriter() returns a CheckedOutputWriter that writes each log
+// entry as an aligned, colourised line for humans to read
+func NewConsoleOutputWriter(config ConsoleWriterConfig) CheckedOutputWriter {
+	// checking for a terminal means a stat() call, so we remember the
+	// answer for the last file that we wrote to
+	//
+	// anything that is not an *os.File cannot be a terminal, so there is
+	// nothing to remember for those
+	var mu sync.Mutex
+	var lastFile *os.File
+	var lastColour bool
+
+	return func(out io.Writer, entry *LogEntry, data map[string]string) error {
+		var colour bool
+		if file, ok := out.(*os.File); ok && config.Colour == ColourAuto {
+			mu.Lock()
+			if file != lastFile {
+				lastFile = file
+				lastColour = shouldUseColour(config.Colour, file)
+			}
+			colour = lastColour
+			mu.Unlock()
+		} else {
+			colour = shouldUseColour(config.Colour, out)
+		}
+
+		buf := new(bytes.Buffer)
+		writeConsoleEntry(buf, &config, colour, entry, data)
+
+		_, err := out.Write(buf.Bytes())
+		return err
+	}
+}
+
+func writeConsoleEntry(buf *bytes.Buffer, config *ConsoleWriterConfig, colour bool, entry *LogEntry, data map[string]string) {
+	paint := func(code string, text string) {
+		if colour && len(code) > 0 {
+			buf.WriteString(code)
+			buf.WriteString(text)
+			buf.WriteString(ansiReset)
+		} else {
+			buf.WriteString(text)
+		}
+	}
+
+	// when
+	timestamp := data[FormatTimestamp]
+	if len(timestamp) == 0 && len(config.TimeFormat) > 0 {
+		timestamp = entry.When.Format(config.TimeFormat)
+	}
+	if len(timestamp) > 0 {
+		paint(ansiFaint, timestamp)
+		buf.WriteString(" ")
+	}
+
+	// how important
+	paint(LogLevelColours[entry.LogLevel], padRight(entry.LogLevel.String(), logLevelNameWidth))
+	buf.WriteString(" ")
+
+	// where from
+	if len(data[FormatFilename]) > 0 {
+		paint(ansiFaint, data[FormatFilename])
+		buf.WriteString(" ")
+	}
+	if len(entry.Module) > 0 || config.ModuleWidth > 0 {
+		moduleColour := ansiBold
+		if config.ColourModules && len(entry.Module) > 0 {
+			moduleColour = colourForModule(entry.Module)
+		}
+		module := entry.Module
+		if len(module) > 0 {
+			module += ":"
+		}
+		paint(moduleColour, padRight(module, config.ModuleWidth+1))
+		buf.WriteString(" ")
+	}
+
+	// what happened
+	buf.WriteString(entry.Message)
+
+	// any additional information
+	for _, key := range sortedFieldKeys(entry.Data) {
+		buf.WriteString(" ")
+		paint(ansiCyan, logfmtKey(key)+"=")
+		writeLogfmtValue(buf, logfmtValueString(entry.Data[key]))
+	}
+
+	buf.WriteString("\n")
+}
+
+// shouldUseColour() decides whether to use colour when writing to out
+func shouldUseColour(mode ColourMode, out io.Writer) bool {
+	switch mode {
+	case ColourAlways:
+		return true
+	case ColourNever:
+		return false
+	}
+
+	// see https://no-color.org/
+	if len(os.Getenv("NO_COLOR")) > 0 || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	return isTerminal(out)
+}
+
+// isTerminal() returns true if out is a terminal
+func isTerminal(out io.Writer) bool {
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// colourForModule() picks a colour for the module, which stays the same
+// every time the program runs
+func colourForModule(module string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(module))
+
+	return moduleColours[hash.Sum32()%uint32(len(moduleColours))]
+}
+
+func padRight(text string, width int) string {
+	if len(text) >= width {
+		return text
+	}
+
+	return text + string(bytes.Repeat([]byte(" "), width-len(text)))
+}
@@ -0,0 +1,55 @@
+package modlog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestConsoleOutputWriterDisablesColourForNonTerminals(t *testing.T) {
+	var buf bytes.Buffer
+	entry := NewLogEntry(WarnLevel, "db", "slow query")
+	entry.When = time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry.Data["ms"] = 120
+	entry.Data["query"] = "select 1"
+
+	ConsoleOutputWriter(&buf, entry, map[string]string{})
+
+	expected := `03:04:05.000 WARNING   db:           slow query ms=120 query="select 1"` + "\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestConsoleOutputWriterColoursLevelAndModule(t *testing.T) {
+	var buf bytes.Buffer
+	entry := NewLogEntry(ErrorLevel, "db", "failed")
+	writer := NewConsoleOutputWriter(ConsoleWriterConfig{Colour: ColourAlways, ColourModules: true})
+
+	writer(&buf, entry, map[string]string{})
+
+	expected := ansiRed + "ERROR    " + ansiReset + " " + colourForModule("db") + "db:" + ansiReset + " failed\n"
+	assert.Equal(t, expected, buf.String())
+	assert.Equal(t, colourForModule("db"), colourForModule("db"))
+}
+
+func TestConsoleOutputWriterAcceptsAnyWriter(t *testing.T) {
+	var buf bytes.Buffer
+	entry := NewLogEntry(InfoLevel, "", "hello")
+	entry.When = time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// a func type cannot be used as a map key
+	out := writerFunc(func(p []byte) (int, error) {
+		return buf.Write(p)
+	})
+	err := ConsoleOutputWriter(out, entry, map[string]string{})
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "03:04:05.000 INFO                    hello\n", buf.String())
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (self writerFunc) Write(p []byte) (int, error) {
+	return self(p)
+}
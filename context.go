@@ -0,0 +1,345 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"context"
+)
+
+// ContextExtractor copies request-scoped values (such as a request ID or
+// a trace ID) out of a context.Context, so that they can be added to
+// LogEntry.Data
+//
+// it returns nil if the context holds nothing of interest
+type ContextExtractor func(ctx context.Context) LogFields
+
+// ContextLogger is anything that can be stored in a context.Context by
+// NewContext(): a *Logger, a *FieldLogger or a *ModuleLogger
+type ContextLogger interface {
+	contextLogger() *ModuleLogger
+}
+
+// the key that NewContext() stores the logger under
+type contextKey struct{}
+
+// ContextValueExtractor() returns a ContextExtractor that copies the
+// value stored in the context under 'key' into the named field
+func ContextValueExtractor(key interface{}, field string) ContextExtractor {
+	return func(ctx context.Context) LogFields {
+		value := ctx.Value(key)
+		if value == nil {
+			return nil
+		}
+
+		return LogFields{field: value}
+	}
+}
+
+// AddContextExtractor() adds an extractor that is run by WithContext(),
+// FromContext() and the *Ctx() logging methods, replacing any
+// existing extractor that has the same name
+//
+// extractors are run in the order that they were added; where two of
+// them return the same field, the later one wins
+func (self *Logger) AddContextExtractor(name string, extractor ContextExtractor) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.extractors == nil {
+		self.extractors = make(map[string]ContextExtractor)
+	}
+	self.extractorOrder.addIfMissing(name)
+	self.extractors[name] = extractor
+}
+
+// RemoveContextExtractor() removes the named extractor
+func (self *Logger) RemoveContextExtractor(name string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	delete(self.extractors, name)
+	self.extractorOrder.remove(name)
+}
+
+// contextFields() runs our extractors over the context
+func (self *Logger) contextFields(ctx context.Context) LogFields {
+	retval := LogFields{}
+	if ctx == nil {
+		return retval
+	}
+
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	for _, slot := range self.extractorOrder.slots {
+		extractor, ok := self.extractors[slot.name]
+		if !ok {
+			continue
+		}
+		for key, value := range extractor(ctx) {
+			retval[key] = value
+		}
+	}
+
+	return retval
+}
+
+// NewContext() returns a copy of ctx that carries the given logger
+func NewContext(ctx context.Context, logger ContextLogger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger.contextLogger())
+}
+
+// FromContext() returns the logger stored in ctx by NewContext(), with
+// the fields from the logger's context extractors attached
+//
+// if ctx holds no logger, the default logger is used
+func FromContext(ctx context.Context) *ModuleLogger {
+	var logger *ModuleLogger
+	if ctx != nil {
+		logger, _ = ctx.Value(contextKey{}).(*ModuleLogger)
+	}
+	if logger == nil {
+		logger = defaultLogger.contextLogger()
+	}
+
+	return logger.WithContext(ctx)
+}
+
+// WithContext() returns a FieldLogger that attaches the fields from our
+// context extractors to every log entry
+func (self *Logger) WithContext(ctx context.Context) *FieldLogger {
+	return self.WithFields(self.contextFields(ctx))
+}
+
+// WithContext() returns a new FieldLogger that attaches our fields plus
+// the fields from the context extractors to every log entry
+func (self *FieldLogger) WithContext(ctx context.Context) *FieldLogger {
+	return self.WithFields(self.logger.contextFields(ctx))
+}
+
+// WithContext() returns a new ModuleLogger that attaches our fields plus
+// the fields from the context extractors to every log entry
+func (self *ModuleLogger) WithContext(ctx context.Context) *ModuleLogger {
+	return self.WithFields(self.logger.contextFields(ctx))
+}
+
+// withContext() returns a copy of this handle that attaches our fields
+// plus the fields from the context extractors to every log entry
+func (self *loggerHandle) withContext(ctx context.Context) *loggerHandle {
+	retval := self.withFields(self.logger.contextFields(ctx))
+	return &retval
+}
+
+func (self *Logger) contextLogger() *ModuleLogger {
+	return &ModuleLogger{loggerHandle: loggerHandle{logger: self}}
+}
+
+func (self *FieldLogger) contextLogger() *ModuleLogger {
+	return &ModuleLogger{loggerHandle: self.loggerHandle}
+}
+
+func (self *ModuleLogger) contextLogger() *ModuleLogger {
+	return self
+}
+
+// the *Ctx() logging methods add the fields from our context extractors
+// to the entry, and then work like their counterparts without the 'Ctx'
+// in the name
+//
+// they are not called *Context() because log/slog already uses those
+// names for methods that take key/value pairs; here, the args are turned
+// into the message, in the same way that fmt.Sprint() does; use
+// WithFields() to attach any other fields, or the *Ctxf() methods to
+// format the message
+
+func (self *Logger) TraceCtx(ctx context.Context, args ...interface{}) {
+	self.WithContext(ctx).Trace(args...)
+}
+
+func (self *Logger) TraceCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.WithContext(ctx).Tracef(format, args...)
+}
+
+func (self *Logger) DebugCtx(ctx context.Context, args ...interface{}) {
+	self.WithContext(ctx).Debug(args...)
+}
+
+func (self *Logger) DebugCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.WithContext(ctx).Debugf(format, args...)
+}
+
+func (self *Logger) InfoCtx(ctx context.Context, args ...interface{}) {
+	self.WithContext(ctx).Info(args...)
+}
+
+func (self *Logger) InfoCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.WithContext(ctx).Infof(format, args...)
+}
+
+func (self *Logger) NoticeCtx(ctx context.Context, args ...interface{}) {
+	self.WithContext(ctx).Notice(args...)
+}
+
+func (self *Logger) NoticeCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.WithContext(ctx).Noticef(format, args...)
+}
+
+func (self *Logger) WarnCtx(ctx context.Context, args ...interface{}) {
+	self.WithContext(ctx).Warn(args...)
+}
+
+func (self *Logger) WarnCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.WithContext(ctx).Warnf(format, args...)
+}
+
+func (self *Logger) ErrorCtx(ctx context.Context, args ...interface{}) {
+	self.WithContext(ctx).Error(args...)
+}
+
+func (self *Logger) ErrorCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.WithContext(ctx).Errorf(format, args...)
+}
+
+func (self *Logger) CriticalCtx(ctx context.Context, args ...interface{}) {
+	self.WithContext(ctx).Critical(args...)
+}
+
+func (self *Logger) CriticalCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.WithContext(ctx).Criticalf(format, args...)
+}
+
+func (self *Logger) AlertCtx(ctx context.Context, args ...interface{}) {
+	self.WithContext(ctx).Alert(args...)
+}
+
+func (self *Logger) AlertCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.WithContext(ctx).Alertf(format, args...)
+}
+
+func (self *Logger) EmergencyCtx(ctx context.Context, args ...interface{}) {
+	self.WithContext(ctx).Emergency(args...)
+}
+
+func (self *Logger) EmergencyCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.WithContext(ctx).Emergencyf(format, args...)
+}
+
+func (self *Logger) FatalCtx(ctx context.Context, args ...interface{}) {
+	self.WithContext(ctx).Fatal(args...)
+}
+
+func (self *Logger) FatalCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.WithContext(ctx).Fatalf(format, args...)
+}
+
+func (self *Logger) PanicCtx(ctx context.Context, args ...interface{}) {
+	self.WithContext(ctx).Panic(args...)
+}
+
+func (self *Logger) PanicCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.WithContext(ctx).Panicf(format, args...)
+}
+
+func (self *Logger) PrintCtx(ctx context.Context, args ...interface{}) {
+	self.WithContext(ctx).Print(args...)
+}
+
+func (self *Logger) PrintCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.WithContext(ctx).Printf(format, args...)
+}
+
+func (self *loggerHandle) TraceCtx(ctx context.Context, args ...interface{}) {
+	self.withContext(ctx).Trace(args...)
+}
+
+func (self *loggerHandle) TraceCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.withContext(ctx).Tracef(format, args...)
+}
+
+func (self *loggerHandle) DebugCtx(ctx context.Context, args ...interface{}) {
+	self.withContext(ctx).Debug(args...)
+}
+
+func (self *loggerHandle) DebugCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.withContext(ctx).Debugf(format, args...)
+}
+
+func (self *loggerHandle) InfoCtx(ctx context.Context, args ...interface{}) {
+	self.withContext(ctx).Info(args...)
+}
+
+func (self *loggerHandle) InfoCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.withContext(ctx).Infof(format, args...)
+}
+
+func (self *loggerHandle) NoticeCtx(ctx context.Context, args ...interface{}) {
+	self.withContext(ctx).Notice(args...)
+}
+
+func (self *loggerHandle) NoticeCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.withContext(ctx).Noticef(format, args...)
+}
+
+func (self *loggerHandle) WarnCtx(ctx context.Context, args ...interface{}) {
+	self.withContext(ctx).Warn(args...)
+}
+
+func (self *loggerHandle) WarnCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.withContext(ctx).Warnf(format, args...)
+}
+
+func (self *loggerHandle) ErrorCtx(ctx context.Context, args ...interface{}) {
+	self.withContext(ctx).Error(args...)
+}
+
+func (self *loggerHandle) ErrorCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.withContext(ctx).Errorf(format, args...)
+}
+
+func (self *loggerHandle) CriticalCtx(ctx context.Context, args ...interface{}) {
+	self.withContext(ctx).Critical(args...)
+}
+
+func (self *loggerHandle) CriticalCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.withContext(ctx).Criticalf(format, args...)
+}
+
+func (self *loggerHandle) AlertCtx(ctx context.Context, args ...interface{}) {
+	self.withContext(ctx).Alert(args...)
+}
+
+func (self *loggerHandle) AlertCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.withContext(ctx).Alertf(format, args...)
+}
+
+func (self *loggerHandle) EmergencyCtx(ctx context.Context, args ...interface{}) {
+	self.withContext(ctx).Emergency(args...)
+}
+
+func (self *loggerHandle) EmergencyCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.withContext(ctx).Emergencyf(format, args...)
+}
+
+func (self *loggerHandle) FatalCtx(ctx context.Context, args ...interface{}) {
+	self.withContext(ctx).Fatal(args...)
+}
+
+func (self *loggerHandle) FatalCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.withContext(ctx).Fatalf(format, args...)
+}
+
+func (self *loggerHandle) PanicCtx(ctx context.Context, args ...interface{}) {
+	self.withContext(ctx).Panic(args...)
+}
+
+func (self *loggerHandle) PanicCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.withContext(ctx).Panicf(format, args...)
+}
+
+func (self *loggerHandle) PrintCtx(ctx context.Context, args ...interface{}) {
+	self.withContext(ctx).Print(args...)
+}
+
+func (self *loggerHandle) PrintCtxf(ctx context.Context, format string, args ...interface{}) {
+	self.withContext(ctx).Printf(format, args...)
+}
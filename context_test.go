@@ -0,0 +1,75 @@
+package modlog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+type testContextKey string
+
+func TestContextMethodsAddExtractedFields(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+	logger.AddContextExtractor("requestId", ContextValueExtractor(testContextKey("requestId"), "request_id"))
+	logger.AddContextExtractor("tenant", func(ctx context.Context) LogFields {
+		tenant, ok := ctx.Value(testContextKey("tenant")).(string)
+		if !ok {
+			return nil
+		}
+		return LogFields{"tenant": tenant}
+	})
+
+	ctx := context.WithValue(context.Background(), testContextKey("requestId"), "abc")
+	logger.Module("http").WithField("path", "/").InfoCtx(ctx, "hello")
+	logger.WarnCtx(context.Background(), "nothing to extract")
+
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "http", entries[0].Module)
+	assert.Equal(t, LogFields{"request_id": "abc", "path": "/"}, entries[0].Data)
+	assert.Equal(t, LogFields{}, entries[1].Data)
+}
+
+func TestFromContextReturnsStoredLogger(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+	logger.AddContextExtractor("requestId", ContextValueExtractor(testContextKey("requestId"), "request_id"))
+
+	ctx := NewContext(context.Background(), logger.Module("db"))
+	ctx = context.WithValue(ctx, testContextKey("requestId"), "xyz")
+
+	FromContext(ctx).Error("failed")
+
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "db", entries[0].Module)
+	assert.Equal(t, "xyz", entries[0].Data["request_id"])
+	assert.Equal(t, defaultLogger, FromContext(context.Background()).Logger())
+}
+
+func TestCtxfMethodsFormatTheMessage(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+	logger.AddContextExtractor("requestId", ContextValueExtractor(testContextKey("requestId"), "request_id"))
+	var exitCode int
+	logger.SetOptions(SetExitFunc(func(code int) { exitCode = code }))
+
+	ctx := context.WithValue(context.Background(), testContextKey("requestId"), "abc")
+	logger.InfoCtxf(ctx, "took %dms", 12)
+	logger.Module("db").PrintCtxf(ctx, "%d rows", 3)
+	logger.WithField("path", "/").FatalCtx(ctx, "giving up")
+
+	// the args are not key/value pairs
+	logger.InfoCtx(ctx, "msg", "k", 1)
+
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, "took 12ms", entries[0].Message)
+	assert.Equal(t, LogFields{"request_id": "abc"}, entries[0].Data)
+	assert.Equal(t, "3 rows", entries[1].Message)
+	assert.Equal(t, "db", entries[1].Module)
+	assert.Equal(t, InfoLevel, entries[1].LogLevel)
+	assert.Equal(t, FatalLevel, entries[2].LogLevel)
+	assert.Equal(t, LogFields{"request_id": "abc", "path": "/"}, entries[2].Data)
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, "msgk1", entries[3].Message)
+}
@@ -3,6 +3,7 @@
 package modlog
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -32,12 +33,51 @@ func SetOptions(logOptions ...LogOption) {
 	defaultLogger.SetOptions(logOptions...)
 }
 
+// Flush() flushes all of the default logger's outputs
+func Flush() error {
+	return defaultLogger.Flush()
+}
+
+// Sync() flushes all of the default logger's outputs, and commits them to
+// stable storage
+func Sync() error {
+	return defaultLogger.Sync()
+}
+
+// Shutdown() waits for the default logger to write out any pending entries,
+// and then closes its outputs
+//
+// it gives up, returning the context's error, if the context is done first
+func Shutdown(ctx context.Context) error {
+	return defaultLogger.Shutdown(ctx)
+}
+
+// Reopen() asks each of the default logger's outputs to reopen its file
+func Reopen() error {
+	return defaultLogger.Reopen()
+}
+
+// ReopenOnSignal() makes the default logger reopen its files every time
+// the process receives one of the given signals; the default is SIGHUP
+func ReopenOnSignal(signals ...os.Signal) func() {
+	return defaultLogger.ReopenOnSignal(signals...)
+}
+
+// RedirectStdLog() sends everything written via the stdlib's log package
+// to the default logger; call the returned function to put it back
+func RedirectStdLog(level LogLevel, module string) func() {
+	return defaultLogger.RedirectStdLog(level, module)
+}
+
 func Flags() int {
 	return defaultLogger.Flags()
 }
 
+// Output() writes the output for a logging event to the default logger
+//
+// It is compatible with the stdlib's log.Output() function
 func Output(calldepth int, s string) error {
-	return defaultLogger.Output(calldepth, s)
+	return defaultLogger.output(calldepth+1, s)
 }
 
 func Prefix() string {
@@ -56,6 +96,35 @@ func SetOutput(out io.Writer) {
 	defaultLogger.SetOutput(out)
 }
 
+// WithFields() returns a FieldLogger that attaches the given fields to
+// every entry sent to the default logger
+func WithFields(fields LogFields) *FieldLogger {
+	return defaultLogger.WithFields(fields)
+}
+
+// WithField() returns a FieldLogger that attaches the given key/value pair
+// to every entry sent to the default logger
+func WithField(key string, value interface{}) *FieldLogger {
+	return defaultLogger.WithField(key, value)
+}
+
+// AddContextExtractor() adds an extractor to the default logger
+func AddContextExtractor(name string, extractor ContextExtractor) {
+	defaultLogger.AddContextExtractor(name, extractor)
+}
+
+// WithContext() returns a FieldLogger that attaches the fields from the
+// default logger's context extractors to every entry
+func WithContext(ctx context.Context) *FieldLogger {
+	return defaultLogger.WithContext(ctx)
+}
+
+// Module() returns a ModuleLogger that writes log entries for the given
+// module to the default logger
+func Module(name string) *ModuleLogger {
+	return defaultLogger.Module(name)
+}
+
 func Tracef(format string, args ...interface{}) {
 	defaultLogger.AddLogEntry(TraceLevel, "", fmt.Sprintf(format, args...))
 }
@@ -166,26 +235,35 @@ func Emergencyln(args ...interface{}) {
 
 func Fatalf(format string, args ...interface{}) {
 	defaultLogger.AddLogEntry(FatalLevel, "", fmt.Sprintf(format, args...))
+	defaultLogger.exit(1)
 }
 
 func Fatal(args ...interface{}) {
 	defaultLogger.AddLogEntry(FatalLevel, "", fmt.Sprint(args...))
+	defaultLogger.exit(1)
 }
 
 func Fatalln(args ...interface{}) {
 	defaultLogger.AddLogEntry(FatalLevel, "", extrafmt.Sprintnln(args...))
+	defaultLogger.exit(1)
 }
 
 func Panicf(format string, args ...interface{}) {
-	defaultLogger.AddLogEntry(PanicLevel, "", fmt.Sprintf(format, args...))
+	message := fmt.Sprintf(format, args...)
+	defaultLogger.AddLogEntry(PanicLevel, "", message)
+	defaultLogger.panic(message)
 }
 
 func Panic(args ...interface{}) {
-	defaultLogger.AddLogEntry(PanicLevel, "", fmt.Sprint(args...))
+	message := fmt.Sprint(args...)
+	defaultLogger.AddLogEntry(PanicLevel, "", message)
+	defaultLogger.panic(message)
 }
 
 func Panicln(args ...interface{}) {
-	defaultLogger.AddLogEntry(PanicLevel, "", extrafmt.Sprintnln(args...))
+	message := extrafmt.Sprintnln(args...)
+	defaultLogger.AddLogEntry(PanicLevel, "", message)
+	defaultLogger.panic(message)
 }
 
 func Printf(format string, args ...interface{}) {
@@ -0,0 +1,141 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"fmt"
+	"time"
+)
+
+// DuplicateOptions controls how a LogOutput collapses repeated entries
+type DuplicateOptions struct {
+	// how long a run of repeated entries can go unreported; defaults to
+	// 30 seconds
+	Timeout time.Duration
+}
+
+// duplicateTracker remembers the last entry that a LogOutput wrote, and
+// how many times it has been repeated since
+//
+// it is protected by the LogOutput's lock
+type duplicateTracker struct {
+	options DuplicateOptions
+
+	// the last entry that we wrote, and a snapshot of the logger that
+	// sent it, for formatting the repeat count once the logger's lock
+	// has been released
+	last   *LogEntry
+	logger *Logger
+
+	// how many times 'last' has been repeated since we last said so
+	repeats int
+
+	// reports the repeats if the run goes on for too long; generation
+	// stops a timer that fires late from reporting the wrong run
+	timer      *time.Timer
+	generation uint64
+}
+
+// SuppressDuplicates() tells this output to collapse consecutive entries
+// that have the same level, module and message into a single entry,
+// followed by 'last message repeated N times' (or '1 time')
+//
+// the repeat count is written when a different entry arrives, when the
+// Timeout expires, or when the output is flushed
+func (self *LogOutput) SuppressDuplicates(options DuplicateOptions) *LogOutput {
+	if options.Timeout <= 0 {
+		options.Timeout = 30 * time.Second
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.writeRepeats()
+	self.duplicates = &duplicateTracker{options: options}
+
+	return self
+}
+
+// AllowDuplicates() undoes SuppressDuplicates()
+func (self *LogOutput) AllowDuplicates() *LogOutput {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.writeRepeats()
+	self.duplicates = nil
+
+	return self
+}
+
+// isRepeat() returns true if the entry repeats the last one that we wrote,
+// and counts it if it does
+//
+// the caller must hold our lock
+func (self *LogOutput) isRepeat(entry *LogEntry) bool {
+	tracker := self.duplicates
+	last := tracker.last
+	if last == nil || last.LogLevel != entry.LogLevel || last.Module != entry.Module || last.Message != entry.Message {
+		return false
+	}
+
+	tracker.repeats++
+	if tracker.timer == nil {
+		generation := tracker.generation
+		tracker.timer = time.AfterFunc(tracker.options.Timeout, func() {
+			self.mu.Lock()
+			defer self.mu.Unlock()
+
+			if self.duplicates == tracker && tracker.generation == generation {
+				self.writeRepeats()
+			}
+		})
+	}
+
+	return true
+}
+
+// rememberEntry() makes a note of the entry that we have just written, so
+// that we can spot it being repeated
+//
+// the caller must hold our lock, and the logger's lock
+func (self *LogOutput) rememberEntry(logger *Logger, entry *LogEntry) {
+	self.duplicates.last = entry
+	self.duplicates.logger = logger.snapshot()
+}
+
+// writeRepeats() writes out how many times the last entry has been
+// repeated, if it has been repeated at all
+//
+// the caller must hold our lock
+func (self *LogOutput) writeRepeats() error {
+	tracker := self.duplicates
+	if tracker == nil {
+		return nil
+	}
+
+	if tracker.timer != nil {
+		tracker.timer.Stop()
+		tracker.timer = nil
+	}
+	tracker.generation++
+
+	if tracker.repeats == 0 || self.closed {
+		return nil
+	}
+
+	last := tracker.last
+	noun := "times"
+	if tracker.repeats == 1 {
+		noun = "time"
+	}
+	summary := NewLogEntry(
+		last.LogLevel,
+		last.Module,
+		fmt.Sprintf("last message repeated %d %s", tracker.repeats, noun),
+	)
+	summary.Data["repeated"] = tracker.repeats
+	summary.Caller = last.Caller
+	tracker.repeats = 0
+
+	return self.formatAndWrite(tracker.logger, summary)
+}
@@ -0,0 +1,74 @@
+package modlog
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func newDuplicateOutput(messages *[]string, options DuplicateOptions) (*Logger, *LogOutput) {
+	logger := NewLogger()
+	output := logger.GetOutput("default").SetCheckedWriter(func(out io.Writer, entry *LogEntry, data map[string]string) error {
+		*messages = append(*messages, entry.Message)
+		return nil
+	})
+	output.SuppressDuplicates(options)
+
+	return logger, output
+}
+
+func TestSuppressDuplicatesCollapsesRuns(t *testing.T) {
+	var messages []string
+	logger, _ := newDuplicateOutput(&messages, DuplicateOptions{Timeout: time.Hour})
+
+	logger.Info("connecting")
+	logger.Info("connecting")
+	logger.Info("connecting")
+	logger.Warn("connecting")
+	logger.Info("connected")
+	logger.Info("connected")
+	logger.Flush()
+
+	expected := []string{
+		"connecting",
+		"last message repeated 2 times",
+		"connecting",
+		"connected",
+		"last message repeated 1 time",
+	}
+	assert.Equal(t, expected, messages)
+}
+
+func TestSuppressDuplicatesReportsAfterTimeout(t *testing.T) {
+	var messages []string
+	logger, output := newDuplicateOutput(&messages, DuplicateOptions{Timeout: 10 * time.Millisecond})
+
+	logger.Info("polling")
+	logger.Info("polling")
+	logger.Info("polling")
+	time.Sleep(50 * time.Millisecond)
+
+	output.mu.Lock()
+	defer output.mu.Unlock()
+	assert.Equal(t, []string{"polling", "last message repeated 2 times"}, messages)
+}
+
+func TestSuppressDuplicatesFormatsRepeatsLikeTheOriginalEntry(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "app: ", 0)
+	output := logger.GetOutput("default").SuppressDuplicates(DuplicateOptions{Timeout: time.Millisecond})
+
+	logger.Print("polling")
+	logger.Print("polling")
+
+	// must not race with the timer that reports the repeat
+	logger.SetPrefix("other: ")
+	time.Sleep(50 * time.Millisecond)
+
+	output.mu.Lock()
+	defer output.mu.Unlock()
+	assert.Equal(t, "app: polling\napp: last message repeated 1 time\n", buf.String())
+}
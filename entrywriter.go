@@ -0,0 +1,218 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"bytes"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the longest line that an EntryWriter waits for; anything longer is
+// logged in pieces
+const maxEntryWriterLine = 64 * 1024
+
+// EntryWriter is an io.Writer that turns each line written to it into a
+// LogEntry
+//
+// use it to capture the output of subprocesses, and of libraries that
+// write their logs to an io.Writer
+type EntryWriter struct {
+	logger *Logger
+	level  LogLevel
+	module string
+
+	// set when the lines come from a stdlib *log.Logger, so that we can
+	// strip off what it has added
+	stdlibFlags  func() int
+	stdlibPrefix func() string
+
+	// any line that we have not seen the end of yet, and whether it is
+	// the first line of a message from a stdlib *log.Logger
+	partial       []byte
+	partialHeader bool
+
+	mu sync.Mutex
+}
+
+// Writer() returns an io.Writer that logs each line written to it at the
+// given level, as the given module
+//
+// call Close() on the writer to log any final line that does not end in
+// a newline
+func (self *Logger) Writer(level LogLevel, module string) *EntryWriter {
+	return &EntryWriter{
+		logger: self,
+		level:  level,
+		module: module,
+	}
+}
+
+// StdlibLogger() returns a stdlib *log.Logger that writes to us, for
+// libraries that insist on one (e.g. http.Server.ErrorLog)
+func (self *Logger) StdlibLogger(level LogLevel, module string) *log.Logger {
+	writer := self.Writer(level, module)
+	retval := log.New(writer, "", log.Llongfile)
+	writer.stdlibFlags = retval.Flags
+	writer.stdlibPrefix = retval.Prefix
+
+	return retval
+}
+
+// RedirectStdLog() sends everything written via the stdlib's log package
+// to us, at the given level and as the given module
+//
+// we strip off whatever the stdlib's flags and prefix add to each message;
+// the stdlib's flags are left alone, so add log.Lshortfile or log.Llongfile
+// to them if you want us to know who wrote each message
+//
+// call the returned function to put everything back
+func (self *Logger) RedirectStdLog(level LogLevel, module string) func() {
+	oldOutput := log.Writer()
+
+	writer := self.Writer(level, module)
+	writer.stdlibFlags = log.Flags
+	writer.stdlibPrefix = log.Prefix
+
+	log.SetOutput(writer)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			log.SetOutput(oldOutput)
+			writer.Close()
+		})
+	}
+}
+
+// Write() logs each complete line in p, and holds on to any incomplete
+// line until the rest of it arrives
+func (self *EntryWriter) Write(p []byte) (int, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	// a stdlib *log.Logger writes each message in a single Write(), and
+	// only the first line of the message has a prefix to strip off
+	header := self.partialHeader
+	if len(self.partial) == 0 {
+		header = true
+	}
+
+	self.partial = append(self.partial, p...)
+	for {
+		i := bytes.IndexByte(self.partial, '\n')
+		if i < 0 {
+			break
+		}
+		self.writeLine(self.partial[:i], header)
+		self.partial = self.partial[i+1:]
+		header = false
+	}
+
+	if len(self.partial) >= maxEntryWriterLine {
+		self.writeLine(self.partial, header)
+		self.partial = nil
+		header = false
+	}
+	self.partialHeader = header
+
+	// don't hang on to a large buffer that we no longer need
+	if len(self.partial) == 0 {
+		self.partial = nil
+	}
+
+	return len(p), nil
+}
+
+// Flush() logs any incomplete line that we are holding on to
+func (self *EntryWriter) Flush() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if len(self.partial) > 0 {
+		self.writeLine(self.partial, self.partialHeader)
+		self.partial = nil
+	}
+
+	return nil
+}
+
+// Close() logs any incomplete line that we are holding on to
+func (self *EntryWriter) Close() error {
+	return self.Flush()
+}
+
+// writeLine() logs a single line
+//
+// header is true if the line is the first line of a message, which is
+// where a stdlib *log.Logger puts its prefix
+//
+// the caller must hold our lock
+func (self *EntryWriter) writeLine(line []byte, header bool) {
+	message := strings.TrimSuffix(string(line), "\r")
+
+	var caller *LogCaller
+	if self.stdlibFlags != nil && header {
+		message, caller = parseStdlibLine(message, self.stdlibFlags(), self.stdlibPrefix())
+	}
+	if len(strings.TrimSpace(message)) == 0 {
+		return
+	}
+
+	// the code that is calling us is whatever wrote to the io.Writer
+	// (often the fmt or log packages), not the code that produced the
+	// line; unless the line told us, we do not know where it came from
+	entry := NewLogEntry(self.level, self.module, message)
+	entry.Caller = caller
+	self.logger.sendEntry(entry)
+}
+
+// parseStdlibLine() strips off the prefix, timestamp and filename that a
+// stdlib *log.Logger adds to the front of each message
+//
+// it returns the message, and the caller if the filename was there
+func parseStdlibLine(line string, flags int, prefix string) (string, *LogCaller) {
+	if flags&log.Lmsgprefix == 0 {
+		line = strings.TrimPrefix(line, prefix)
+	}
+
+	// the date and time are always the same width
+	if flags&log.Ldate != 0 && len(line) >= len("2006/01/02 ") {
+		line = line[len("2006/01/02 "):]
+	}
+	if flags&(log.Ltime|log.Lmicroseconds) != 0 {
+		width := len("15:04:05 ")
+		if flags&log.Lmicroseconds != 0 {
+			width += len(".000000")
+		}
+		if len(line) >= width {
+			line = line[width:]
+		}
+	}
+
+	var caller *LogCaller
+	if flags&(log.Lshortfile|log.Llongfile) != 0 {
+		// file names can contain colons (e.g. on Windows), so we look
+		// for the last one before the message
+		end := strings.Index(line, ": ")
+		if end > 0 {
+			location := line[:end]
+			colon := strings.LastIndexByte(location, ':')
+			if colon > 0 {
+				lineNo, err := strconv.Atoi(location[colon+1:])
+				if err == nil {
+					caller = &LogCaller{File: location[:colon], Line: lineNo}
+					line = line[end+2:]
+				}
+			}
+		}
+	}
+
+	if flags&log.Lmsgprefix != 0 {
+		line = strings.TrimPrefix(line, prefix)
+	}
+
+	return line, caller
+}
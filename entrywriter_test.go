@@ -0,0 +1,72 @@
+package modlog
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestWriterLogsEachLine(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+	writer := logger.Writer(WarnLevel, "subprocess")
+
+	fmt.Fprint(writer, "first line\r\nsecond ")
+	fmt.Fprint(writer, "line\n\nthird line")
+	assert.Equal(t, 2, len(entries))
+
+	writer.Close()
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "first line", entries[0].Message)
+	assert.Equal(t, "second line", entries[1].Message)
+	assert.Equal(t, "third line", entries[2].Message)
+	assert.Equal(t, WarnLevel, entries[2].LogLevel)
+	assert.Equal(t, "subprocess", entries[2].Module)
+
+	// we cannot tell where the lines came from
+	var unknown *LogCaller
+	assert.Equal(t, unknown, entries[0].Caller)
+}
+
+func TestRedirectStdLogStripsPrefixAndFlags(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+
+	oldPrefix := log.Prefix()
+	oldFlags := log.Flags()
+	log.SetPrefix("lib: ")
+	log.SetFlags(log.LstdFlags | log.Llongfile)
+	defer func() {
+		log.SetPrefix(oldPrefix)
+		log.SetFlags(oldFlags)
+	}()
+
+	restore := logger.RedirectStdLog(ErrorLevel, "stdlib")
+	log.Printf("it broke")
+	log.Printf("it broke again\nat 2014/01/02 03:04:05 db.go:12: timeout")
+	restore()
+
+	// we leave the stdlib's flags alone
+	assert.Equal(t, log.LstdFlags|log.Llongfile, log.Flags())
+
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "it broke", entries[0].Message)
+	assert.Equal(t, ErrorLevel, entries[0].LogLevel)
+	assert.T(t, strings.HasSuffix(entries[0].Caller.File, "entrywriter_test.go"))
+
+	// only the first line of each message has the stdlib's prefix
+	assert.Equal(t, "it broke again", entries[1].Message)
+	assert.Equal(t, "at 2014/01/02 03:04:05 db.go:12: timeout", entries[2].Message)
+	var unknown *LogCaller
+	assert.Equal(t, unknown, entries[2].Caller)
+}
+
+func TestParseStdlibLine(t *testing.T) {
+	message, caller := parseStdlibLine("app: 2014/01/02 03:04:05.123456 main.go:12: hello: world", log.LstdFlags|log.Lmicroseconds|log.Lshortfile, "app: ")
+
+	assert.Equal(t, "hello: world", message)
+	assert.Equal(t, &LogCaller{File: "main.go", Line: 12}, caller)
+}
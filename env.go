@@ -0,0 +1,177 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// the environment variables that ConfigureFromEnv() looks at
+const (
+	// the minimum log level, e.g. 'debug'
+	EnvLogLevel = "MODLOG_LEVEL"
+
+	// per-module log levels, e.g. 'db=debug,http=warn'
+	EnvModuleLogLevels = "MODLOG_MODULES"
+
+	// the format for the default output: json, logfmt, console or text
+	EnvFormat = "MODLOG_FORMAT"
+
+	// where the default output writes to: stderr, stdout or file:/path
+	EnvOutput = "MODLOG_OUTPUT"
+)
+
+// the writers that MODLOG_FORMAT can choose from
+var envFormats = map[string]CheckedOutputWriter{
+	"json":    JSONOutputWriter,
+	"logfmt":  LogfmtOutputWriter,
+	"console": ConsoleOutputWriter,
+	"text":    DefaultCheckedOutputWriter,
+}
+
+// ConfigureFromEnv() configures the default logger from the MODLOG_*
+// environment variables
+func ConfigureFromEnv() error {
+	return defaultLogger.ConfigureFromEnv()
+}
+
+// ConfigureFromEnv() configures this logger from the MODLOG_* environment
+// variables; any that are not set are left alone
+//
+// setting MODLOG_OUTPUT replaces (and closes) the output called 'default',
+// using MODLOG_FORMAT or else 'text'; setting only MODLOG_FORMAT changes
+// the format of the 'default' output, and it keeps writing to the same
+// place
+//
+// nothing is changed if any of the variables hold a value that we do not
+// understand
+func (self *Logger) ConfigureFromEnv() error {
+	return self.configureFromEnv(os.Getenv)
+}
+
+// configureFromEnv() does the work for ConfigureFromEnv(), using getenv
+// to read each variable
+func (self *Logger) configureFromEnv(getenv func(string) string) error {
+	var logOptions []LogOption
+
+	// check everything before we change anything
+	if value := getenv(EnvLogLevel); len(value) > 0 {
+		level, err := ParseLogLevel(value)
+		if err != nil {
+			return fmt.Errorf("%s: %s; expected one of: %s", EnvLogLevel, err.Error(), logLevelNamesList())
+		}
+		logOptions = append(logOptions, SetMinLogLevel(level))
+	}
+
+	if value := getenv(EnvModuleLogLevels); len(value) > 0 {
+		levels, err := ParseModuleLogLevels(value)
+		if err != nil {
+			return fmt.Errorf("%s: %s", EnvModuleLogLevels, err.Error())
+		}
+		logOptions = append(logOptions, SetModuleLogLevels(levels))
+	}
+
+	format := strings.ToLower(strings.TrimSpace(getenv(EnvFormat)))
+	outputSpec := strings.TrimSpace(getenv(EnvOutput))
+	if len(format) > 0 || len(outputSpec) > 0 {
+		if len(format) == 0 {
+			format = "text"
+		}
+		writer, ok := envFormats[format]
+		if !ok {
+			return fmt.Errorf("%s: unknown format '%s'; expected one of: %s", EnvFormat, format, envFormatsList())
+		}
+
+		var out io.Writer
+		if len(outputSpec) > 0 {
+			var err error
+			out, err = openEnvOutput(outputSpec)
+			if err != nil {
+				return err
+			}
+		}
+
+		logOptions = append(logOptions, func(self *Logger) error {
+			old := self.GetOutput("default")
+
+			// with only a format, we keep writing to the same place
+			if out == nil && old != nil {
+				old.SetCheckedWriter(writer)
+				return nil
+			}
+			if out == nil {
+				out = os.Stderr
+			}
+
+			output := self.AddOutput("default", out).SetCheckedWriter(writer)
+			if format == "text" {
+				output.AddFormatter(FormatTimestamp, StdlibDateTimeFormatter).
+					AddFormatter(FormatLogLevel, ShortLogLevelFormatter)
+			}
+
+			// don't leak the file that we were writing to before
+			if old != nil {
+				old.Close()
+			}
+			return nil
+		})
+	}
+
+	// now we can apply everything
+	for _, option := range logOptions {
+		err := option(self)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openEnvOutput() converts the value of MODLOG_OUTPUT into an io.Writer
+func openEnvOutput(spec string) (io.Writer, error) {
+	switch {
+	case len(spec) == 0 || spec == "stderr":
+		return os.Stderr, nil
+	case spec == "stdout":
+		return os.Stdout, nil
+	case strings.HasPrefix(spec, "file:"):
+		path := strings.TrimPrefix(spec, "file:")
+		if len(path) == 0 {
+			return nil, fmt.Errorf("%s: no path given after 'file:'", EnvOutput)
+		}
+		file, err := OpenReopenableFile(path, ReopenOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", EnvOutput, err.Error())
+		}
+		return file, nil
+	}
+
+	return nil, fmt.Errorf("%s: unknown output '%s'; expected stderr, stdout or file:/path", EnvOutput, spec)
+}
+
+// logLevelNamesList() returns the names in LogLevels, for error messages
+func logLevelNamesList() string {
+	names := make([]string, 0, len(LogLevels))
+	for name := range LogLevels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// envFormatsList() returns the names in envFormats, for error messages
+func envFormatsList() string {
+	names := make([]string, 0, len(envFormats))
+	for name := range envFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,92 @@
+package modlog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func fakeEnv(env map[string]string) func(string) string {
+	return func(name string) string {
+		return env[name]
+	}
+}
+
+func TestConfigureFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	logger := NewLogger()
+
+	err := logger.configureFromEnv(fakeEnv(map[string]string{
+		EnvLogLevel:        "WARN",
+		EnvModuleLogLevels: "db=debug",
+		EnvFormat:          "logfmt",
+		EnvOutput:          "file:" + path,
+	}))
+	assert.Equal(t, nil, err)
+
+	logger.Info("dropped")
+	logger.Module("db").Debug("kept")
+	logger.Close()
+
+	contents, err := os.ReadFile(path)
+	assert.Equal(t, nil, err)
+	assert.T(t, strings.HasSuffix(string(contents), "level=debug module=db msg=kept\n"))
+	assert.Equal(t, 1, strings.Count(string(contents), "\n"))
+}
+
+func TestConfigureFromEnvRejectsUnknownValues(t *testing.T) {
+	logger := NewLogger()
+
+	err := logger.configureFromEnv(fakeEnv(map[string]string{
+		EnvModuleLogLevels: "db=debug",
+		EnvLogLevel:        "verbose",
+	}))
+	assert.T(t, strings.HasPrefix(err.Error(), "MODLOG_LEVEL: unknown log level 'verbose'; expected one of: alert, crit"))
+
+	// nothing was changed
+	_, ok := logger.Options.Option("moduleLogLevels")
+	assert.Equal(t, false, ok)
+
+	err = logger.configureFromEnv(fakeEnv(map[string]string{EnvFormat: "xml"}))
+	assert.Equal(t, "MODLOG_FORMAT: unknown format 'xml'; expected one of: console, json, logfmt, text", err.Error())
+
+	err = logger.configureFromEnv(fakeEnv(map[string]string{EnvOutput: "syslog"}))
+	assert.Equal(t, "MODLOG_OUTPUT: unknown output 'syslog'; expected stderr, stdout or file:/path", err.Error())
+}
+
+func TestConfigureFromEnvWithOnlyAFormatKeepsTheOutput(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "app: ", 0)
+	formatters := logger.GetOutput("default").FormatterNames()
+
+	err := logger.configureFromEnv(fakeEnv(map[string]string{EnvFormat: "logfmt"}))
+	assert.Equal(t, nil, err)
+
+	output := logger.GetOutput("default")
+	assert.Equal(t, &buf, output.Out)
+	assert.Equal(t, formatters, output.FormatterNames())
+
+	logger.Info("hello")
+	assert.T(t, strings.Contains(buf.String(), " level=info msg=hello "))
+}
+
+func TestConfigureFromEnvClosesTheOutputThatItReplaces(t *testing.T) {
+	dir := t.TempDir()
+	logger := NewLogger()
+
+	err := logger.configureFromEnv(fakeEnv(map[string]string{EnvOutput: "file:" + filepath.Join(dir, "one.log")}))
+	assert.Equal(t, nil, err)
+	first := logger.GetOutput("default")
+
+	err = logger.configureFromEnv(fakeEnv(map[string]string{EnvOutput: "file:" + filepath.Join(dir, "two.log")}))
+	assert.Equal(t, nil, err)
+	defer logger.Close()
+
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	assert.Equal(t, true, first.closed)
+}
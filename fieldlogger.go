@@ -0,0 +1,49 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+// FieldLogger is a Logger that attaches a fixed set of fields to every
+// LogEntry that it creates
+//
+// it has the same logging methods as ModuleLogger, but puts no module on
+// the entries that it creates
+//
+// Use Logger.WithFields() or Logger.WithField() to create one
+type FieldLogger struct {
+	loggerHandle
+}
+
+// WithFields() returns a FieldLogger that attaches the given fields to
+// every log entry
+func (self *Logger) WithFields(fields LogFields) *FieldLogger {
+	handle := loggerHandle{logger: self}
+	return &FieldLogger{loggerHandle: handle.withFields(fields)}
+}
+
+// WithField() returns a FieldLogger that attaches the given key/value pair
+// to every log entry
+func (self *Logger) WithField(key string, value interface{}) *FieldLogger {
+	return self.WithFields(LogFields{key: value})
+}
+
+// WithFields() returns a new FieldLogger that attaches our fields plus
+// the given fields to every log entry
+//
+// where the same key appears in both, the new value wins
+func (self *FieldLogger) WithFields(fields LogFields) *FieldLogger {
+	return &FieldLogger{loggerHandle: self.withFields(fields)}
+}
+
+// WithField() returns a new FieldLogger that attaches our fields plus
+// the given key/value pair to every log entry
+func (self *FieldLogger) WithField(key string, value interface{}) *FieldLogger {
+	return self.WithFields(LogFields{key: value})
+}
+
+func (self *FieldLogger) AddLogEntry(level LogLevel, module string, message string) {
+	entry := NewLogEntry(level, module, message)
+	for key, value := range self.fields {
+		entry.Data[key] = value
+	}
+	self.logger.processEntry(entry)
+}
@@ -0,0 +1,54 @@
+package modlog
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func newCapturingLogger(entries *[]*LogEntry) *Logger {
+	logger := NewLogger()
+	logger.GetOutput("default").SetCheckedWriter(func(out io.Writer, entry *LogEntry, data map[string]string) error {
+		*entries = append(*entries, entry)
+		return nil
+	})
+	return logger
+}
+
+func TestWithFieldsAttachesDataToEntries(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+
+	logger.WithFields(LogFields{"requestId": "abc"}).WithField("userId", 42).Info("hello")
+
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "hello", entries[0].Message)
+	assert.Equal(t, "abc", entries[0].Data["requestId"])
+	assert.Equal(t, 42, entries[0].Data["userId"])
+}
+
+func TestWithFieldsDoesNotModifyParent(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+
+	parent := logger.WithField("a", 1)
+	_ = parent.WithField("b", 2)
+	parent.Warn("hello")
+
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, 1, len(entries[0].Data))
+	assert.Equal(t, WarnLevel, entries[0].LogLevel)
+}
+
+func TestWithFieldsCopiesCallerMap(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "", 0)
+
+	fields := LogFields{"a": 1}
+	fieldLogger := logger.WithFields(fields)
+	fields["b"] = 2
+
+	assert.Equal(t, LogFields{"a": 1}, fieldLogger.Fields())
+}
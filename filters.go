@@ -39,3 +39,21 @@ func FilterLogToMinLevel(os *options.OptionsStore, entry *LogEntry) bool {
 
 	return false
 }
+
+// FilterLogToModuleLevel() applies the log level set for the entry's module
+// by SetModuleLogLevels()
+//
+// if no level has been set for the module, it falls back to the level set
+// by SetMinLogLevel()
+func FilterLogToModuleLevel(os *options.OptionsStore, entry *LogEntry) bool {
+	option, ok := os.Option("moduleLogLevels")
+	if ok {
+		moduleLogLevels := option.(ModuleLogLevels)
+		level, ok := moduleLogLevels.LevelFor(entry.Module)
+		if ok {
+			return entry.LogLevel <= level
+		}
+	}
+
+	return FilterLogToMinLevel(os, entry)
+}
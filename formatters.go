@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"path"
-	"runtime"
 )
 
 // LogFormatter is the signature that all output formatters much satisfy
@@ -79,16 +78,15 @@ func StdlibFileFormatter(logger *Logger, entry *LogEntry) string {
 		return ""
 	}
 
-	// get the caller
-	_, file, line, ok := runtime.Caller(5)
-	if !ok {
+	// do we know who the caller is?
+	if entry.Caller == nil {
 		return "unknown:00"
 	}
 
 	// Lshortfile overrides Llongfile in the upstream_tests
 	if logger.StdlibFlags&Lshortfile != 0 {
-		return fmt.Sprintf("%s:%d", path.Base(file), line)
+		return fmt.Sprintf("%s:%d", path.Base(entry.Caller.File), entry.Caller.Line)
 	} else {
-		return fmt.Sprintf("%s:%d", file, line)
+		return fmt.Sprintf("%s:%d", entry.Caller.File, entry.Caller.Line)
 	}
 }
@@ -0,0 +1,208 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the socket that systemd-journald listens on for its native protocol
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+// JournaldConfig controls the journal entries that
+// NewJournaldOutputWriter() writes
+type JournaldConfig struct {
+	// the SYSLOG_IDENTIFIER for entries that have no module; defaults to
+	// the name of the running program
+	Identifier string
+}
+
+// JournaldConn is an io.Writer that sends each Write() to systemd-journald
+// as a single journal entry
+//
+// entries that are too large for a single datagram are passed to journald
+// in a sealed memfd instead
+type JournaldConn struct {
+	// journald's socket
+	addr *net.UnixAddr
+
+	// our (unconnected) socket; passing file descriptors does not work
+	// over a connected datagram socket
+	conn *net.UnixConn
+
+	mu sync.Mutex
+}
+
+// DialJournald() connects to systemd-journald's native protocol socket
+//
+// pass "" to use DefaultJournaldSocket
+func DialJournald(socketPath string) (*JournaldConn, error) {
+	if len(socketPath) == 0 {
+		socketPath = DefaultJournaldSocket
+	}
+
+	// is journald running?
+	_, err := os.Stat(socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	retval := &JournaldConn{
+		addr: &net.UnixAddr{Name: socketPath, Net: "unixgram"},
+		conn: conn,
+	}
+	return retval, nil
+}
+
+// AddJournaldOutput() creates a new output that sends log entries to
+// systemd-journald
+func (self *Logger) AddJournaldOutput(name string, config JournaldConfig) (*LogOutput, error) {
+	conn, err := DialJournald("")
+	if err != nil {
+		return nil, err
+	}
+
+	return self.AddOutput(name, conn).SetCheckedWriter(NewJournaldOutputWriter(config)), nil
+}
+
+// Write() sends p to journald as a single journal entry
+func (self *JournaldConn) Write(p []byte) (int, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	_, err := self.conn.WriteToUnix(p, self.addr)
+	if err != nil && isMessageTooLarge(err) {
+		err = sendJournalEntryViaFd(self.conn, self.addr, p)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close() closes the connection to journald
+func (self *JournaldConn) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.conn.Close()
+}
+
+// NewJournaldOutputWriter() returns a CheckedOutputWriter that serialises each
+// log entry using journald's native protocol
+//
+// use it with a JournaldConn
+func NewJournaldOutputWriter(config JournaldConfig) CheckedOutputWriter {
+	if len(config.Identifier) == 0 {
+		config.Identifier = filepath.Base(os.Args[0])
+	}
+
+	return func(out io.Writer, entry *LogEntry, data map[string]string) error {
+		buf := new(bytes.Buffer)
+		writeJournalEntry(buf, &config, entry)
+
+		_, err := out.Write(buf.Bytes())
+		return err
+	}
+}
+
+func writeJournalEntry(buf *bytes.Buffer, config *JournaldConfig, entry *LogEntry) {
+	// journald has no trace level, so we send those as debug messages
+	level := entry.LogLevel
+	if level > DebugLevel {
+		level = DebugLevel
+	}
+
+	identifier := entry.Module
+	if len(identifier) == 0 {
+		identifier = config.Identifier
+	}
+
+	// the fields that we set ourselves
+	written := map[string]bool{}
+	writeJournalField(buf, written, "MESSAGE", entry.Message)
+	writeJournalField(buf, written, "PRIORITY", strconv.Itoa(int(level)))
+	writeJournalField(buf, written, "SYSLOG_IDENTIFIER", identifier)
+	if entry.Caller != nil {
+		writeJournalField(buf, written, "CODE_FILE", entry.Caller.File)
+		writeJournalField(buf, written, "CODE_LINE", strconv.Itoa(entry.Caller.Line))
+		writeJournalField(buf, written, "CODE_FUNC", entry.Caller.Function)
+	}
+
+	// any additional information
+	for _, key := range sortedFieldKeys(entry.Data) {
+		writeJournalField(buf, written, journalFieldName(key), logfmtValueString(entry.Data[key]))
+	}
+}
+
+// writeJournalField() writes a single field using journald's native
+// protocol
+//
+// fields that have already been written are skipped
+func writeJournalField(buf *bytes.Buffer, written map[string]bool, name string, value string) {
+	if written[name] {
+		return
+	}
+	written[name] = true
+
+	buf.WriteString(name)
+
+	// values that contain a newline must be written with their length
+	// in front
+	if strings.IndexByte(value, '\n') < 0 {
+		buf.WriteString("=")
+		buf.WriteString(value)
+		buf.WriteString("\n")
+		return
+	}
+
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(len(value)))
+	buf.WriteString("\n")
+	buf.Write(length[:])
+	buf.WriteString(value)
+	buf.WriteString("\n")
+}
+
+// journalFieldName() converts a LogEntry.Data key into a valid journal
+// field name
+//
+// journal field names are made from uppercase letters, digits and
+// underscores; they cannot start with an underscore or a digit, and
+// are at most 64 characters long
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, key)
+
+	name = strings.TrimLeft(name, "_")
+	if len(name) == 0 || (name[0] >= '0' && name[0] <= '9') {
+		name = "FIELD_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	return name
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+
+//go:build linux
+// +build linux
+
+package modlog
+
+import (
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// the memfd_create() syscall number, which the syscall package does not
+// define for every architecture
+var memfdCreateSyscalls = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"mips":     4354,
+	"mipsle":   4354,
+	"mips64":   5314,
+	"mips64le": 5314,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"riscv64":  279,
+	"s390x":    350,
+}
+
+// flags and seals from linux/memfd.h and linux/fcntl.h
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fAddSeals       = 1033
+	fSealAll        = 0x1 | 0x2 | 0x4 | 0x8
+)
+
+// isMessageTooLarge() returns true if journald could not accept an entry
+// as a single datagram
+func isMessageTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// sendJournalEntryViaFd() writes the entry to a sealed memfd (or, on older
+// kernels, an unlinked file in /dev/shm), and passes that to journald
+func sendJournalEntryViaFd(conn *net.UnixConn, addr *net.UnixAddr, p []byte) error {
+	file, err := journalEntryFile(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, _, err = conn.WriteMsgUnix(nil, syscall.UnixRights(int(file.Fd())), addr)
+	return err
+}
+
+func journalEntryFile(p []byte) (*os.File, error) {
+	file, err := journalMemfd(p)
+	if err == nil {
+		return file, nil
+	}
+
+	// no memfd support; journald will accept a regular file instead
+	file, err = os.CreateTemp("/dev/shm", "modlog-journal-")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(file.Name())
+
+	_, err = file.Write(p)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// journalMemfd() writes p to a new memfd, and seals it so that journald
+// knows that it cannot change underneath it
+func journalMemfd(p []byte) (*os.File, error) {
+	syscallNo, ok := memfdCreateSyscalls[runtime.GOARCH]
+	if !ok {
+		return nil, errors.New("memfd_create() is not supported on " + runtime.GOARCH)
+	}
+
+	name := []byte("modlog-journal\x00")
+	fd, _, errno := syscall.Syscall(syscallNo, uintptr(unsafe.Pointer(&name[0])), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	file := os.NewFile(fd, "modlog-journal")
+
+	_, err := file.Write(p)
+	if err == nil {
+		_, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, fAddSeals, fSealAll)
+		if errno != 0 {
+			err = errno
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
@@ -0,0 +1,82 @@
+//go:build linux
+// +build linux
+
+package modlog
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+// listenJournald() creates a unixgram socket for a JournaldConn to write to
+func listenJournald(t *testing.T) (*net.UnixConn, string) {
+	path := filepath.Join(t.TempDir(), "journal.socket")
+	listener, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	assert.Equal(t, nil, err)
+	t.Cleanup(func() { listener.Close() })
+
+	return listener, path
+}
+
+func TestJournaldOutputSendsEachEntryAsADatagram(t *testing.T) {
+	listener, path := listenJournald(t)
+
+	conn, err := DialJournald(path)
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+
+	l := NewLogger()
+	l.AddOutput("default", conn).SetCheckedWriter(NewJournaldOutputWriter(JournaldConfig{Identifier: "app"}))
+	l.WithField("request_id", "abc").Warn("slow query")
+
+	buf := make([]byte, 4096)
+	n, err := listener.Read(buf)
+	assert.Equal(t, nil, err)
+
+	received := string(buf[:n])
+	assert.Equal(t, true, strings.HasPrefix(received, "MESSAGE=slow query\nPRIORITY=4\nSYSLOG_IDENTIFIER=app\n"), received)
+	assert.Equal(t, true, strings.HasSuffix(received, "REQUEST_ID=abc\n"), received)
+}
+
+func TestJournaldConnPassesLargeEntriesAsAFile(t *testing.T) {
+	listener, path := listenJournald(t)
+
+	conn, err := DialJournald(path)
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+
+	// far too large for a single datagram
+	entry := []byte("MESSAGE=" + strings.Repeat("x", 4*1024*1024) + "\n")
+	n, err := conn.Write(entry)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, len(entry), n)
+
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := listener.ReadMsgUnix(nil, oob)
+	assert.Equal(t, nil, err)
+	messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(messages))
+	fds, err := syscall.ParseUnixRights(&messages[0])
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(fds))
+
+	file := os.NewFile(uintptr(fds[0]), "journal entry")
+	defer file.Close()
+	file.Seek(0, 0)
+	var received bytes.Buffer
+	received.ReadFrom(file)
+	assert.Equal(t, true, bytes.Equal(entry, received.Bytes()))
+}
+
+func TestDialJournaldFailsWhenJournaldIsNotRunning(t *testing.T) {
+	_, err := DialJournald(filepath.Join(t.TempDir(), "missing.socket"))
+	assert.Equal(t, true, os.IsNotExist(err))
+}
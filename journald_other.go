@@ -0,0 +1,23 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+
+//go:build !linux
+// +build !linux
+
+package modlog
+
+import (
+	"errors"
+	"net"
+)
+
+// isMessageTooLarge() returns true if journald could not accept an entry
+// as a single datagram
+func isMessageTooLarge(err error) bool {
+	return false
+}
+
+// sendJournalEntryViaFd() is only supported on Linux
+func sendJournalEntryViaFd(conn *net.UnixConn, addr *net.UnixAddr, p []byte) error {
+	return errors.New("journald is only supported on Linux")
+}
@@ -0,0 +1,98 @@
+package modlog
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestJournalFieldName(t *testing.T) {
+	testData := []struct {
+		key      string
+		expected string
+	}{
+		{"request_id", "REQUEST_ID"},
+		{"Request-ID", "REQUEST_ID"},
+		{"http.status", "HTTP_STATUS"},
+		{"_private", "PRIVATE"},
+		{"__", "FIELD_"},
+		{"", "FIELD_"},
+		{"2fa", "FIELD_2FA"},
+		{"héllo", "H_LLO"},
+		{"abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz", "ABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKL"},
+	}
+
+	for _, testCase := range testData {
+		assert.Equal(t, testCase.expected, journalFieldName(testCase.key), testCase.key)
+	}
+}
+
+func TestWriteJournalField(t *testing.T) {
+	testData := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"MESSAGE", "hello world", "MESSAGE=hello world\n"},
+		{"MESSAGE", "", "MESSAGE=\n"},
+		{"MESSAGE", "a=b", "MESSAGE=a=b\n"},
+		// values with a newline are written with their length in front,
+		// as a 64-bit little-endian number
+		{"MESSAGE", "two\nlines", "MESSAGE\n\x09\x00\x00\x00\x00\x00\x00\x00two\nlines\n"},
+		{"STACK", "\n", "STACK\n\x01\x00\x00\x00\x00\x00\x00\x00\n\n"},
+	}
+
+	for _, testCase := range testData {
+		var buf bytes.Buffer
+		writeJournalField(&buf, map[string]bool{}, testCase.name, testCase.value)
+		assert.Equal(t, testCase.expected, buf.String(), testCase.value)
+	}
+}
+
+func TestWriteJournalEntry(t *testing.T) {
+	testData := []struct {
+		name     string
+		entry    *LogEntry
+		expected string
+	}{
+		{
+			name:  "no module uses the identifier",
+			entry: &LogEntry{LogLevel: InfoLevel, Message: "hello"},
+			expected: "MESSAGE=hello\n" +
+				"PRIORITY=6\n" +
+				"SYSLOG_IDENTIFIER=app\n",
+		},
+		{
+			name:  "module, caller and trace level",
+			entry: &LogEntry{LogLevel: TraceLevel, Module: "db", Message: "query", Caller: &LogCaller{File: "/src/db.go", Line: 12, Function: "db.Query"}},
+			expected: "MESSAGE=query\n" +
+				"PRIORITY=7\n" +
+				"SYSLOG_IDENTIFIER=db\n" +
+				"CODE_FILE=/src/db.go\n" +
+				"CODE_LINE=12\n" +
+				"CODE_FUNC=db.Query\n",
+		},
+		{
+			name: "data cannot override our fields",
+			entry: &LogEntry{LogLevel: ErrorLevel, Message: "failed", Data: LogFields{
+				"message":  "ignored",
+				"priority": 1,
+				"table":    "users",
+				"error":    "line one\nline two",
+			}},
+			expected: "MESSAGE=failed\n" +
+				"PRIORITY=3\n" +
+				"SYSLOG_IDENTIFIER=app\n" +
+				"ERROR\n\x11\x00\x00\x00\x00\x00\x00\x00line one\nline two\n" +
+				"TABLE=users\n",
+		},
+	}
+
+	config := JournaldConfig{Identifier: "app"}
+	for _, testCase := range testData {
+		var buf bytes.Buffer
+		writeJournalEntry(&buf, &config, testCase.entry)
+		assert.Equal(t, testCase.expected, buf.String(), testCase.name)
+	}
+}
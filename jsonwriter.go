@@ -0,0 +1,183 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// JSONWriterConfig controls the key names and formats used by the output
+// writer that NewJSONOutputWriter() creates
+type JSONWriterConfig struct {
+	// the keys to write the LogEntry's own fields under
+	//
+	// set any of these to "" to leave that field out
+	TimeKey    string
+	LevelKey   string
+	ModuleKey  string
+	MessageKey string
+
+	// if set, LogEntry.Data is written as a nested object under this key;
+	// otherwise each field is written at the top level
+	FieldsKey string
+
+	// the layout to pass to time.Format() for the TimeKey field
+	TimeFormat string
+}
+
+// DefaultJSONWriterConfig is the config used by JSONOutputWriter()
+var DefaultJSONWriterConfig = JSONWriterConfig{
+	TimeKey:    "time",
+	LevelKey:   "level",
+	ModuleKey:  "module",
+	MessageKey: "msg",
+	TimeFormat: time.RFC3339Nano,
+}
+
+// JSONOutputWriter() writes each log entry as a single line of JSON,
+// using the key names in DefaultJSONWriterConfig
+func JSONOutputWriter(out io.Writer, entry *LogEntry, data map[string]string) error {
+	return writeJSONEntry(out, entry, data, &DefaultJSONWriterConfig)
+}
+
+// NewJSONOutputWriter() returns a CheckedOutputWriter that writes each log entry
+// as a single line of JSON, using the given key names
+func NewJSONOutputWriter(config JSONWriterConfig) CheckedOutputWriter {
+	return func(out io.Writer, entry *LogEntry, data map[string]string) error {
+		return writeJSONEntry(out, entry, data, &config)
+	}
+}
+
+func writeJSONEntry(out io.Writer, entry *LogEntry, data map[string]string, config *JSONWriterConfig) error {
+	buf := new(bytes.Buffer)
+	obj := newJSONObjectWriter(buf)
+
+	// the LogEntry's own fields always come first
+	if len(config.TimeKey) > 0 {
+		obj.writeValue(config.TimeKey, entry.When.Format(config.TimeFormat))
+	}
+	if len(config.LevelKey) > 0 {
+		obj.writeValue(config.LevelKey, entry.LogLevel.String())
+	}
+	if len(config.ModuleKey) > 0 && len(entry.Module) > 0 {
+		obj.writeValue(config.ModuleKey, entry.Module)
+	}
+	if len(config.MessageKey) > 0 {
+		obj.writeValue(config.MessageKey, entry.Message)
+	}
+
+	// then the output from our formatters
+	for _, key := range sortedStringKeys(data) {
+		if len(data[key]) > 0 {
+			obj.writeValue(key, data[key])
+		}
+	}
+
+	// and finally any additional information
+	if len(config.FieldsKey) > 0 {
+		if len(entry.Data) > 0 {
+			nested := new(bytes.Buffer)
+			fields := newJSONObjectWriter(nested)
+			for _, key := range sortedFieldKeys(entry.Data) {
+				fields.writeValue(key, entry.Data[key])
+			}
+			fields.close()
+			obj.writeRaw(config.FieldsKey, nested.Bytes())
+		}
+	} else {
+		for _, key := range sortedFieldKeys(entry.Data) {
+			obj.writeValue(key, entry.Data[key])
+		}
+	}
+
+	obj.close()
+	buf.WriteString("\n")
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+// jsonObjectWriter builds a JSON object one key at a time, preserving
+// the order in which keys are written
+//
+// the first value written for any key wins; later duplicates are dropped
+type jsonObjectWriter struct {
+	buf  *bytes.Buffer
+	seen map[string]bool
+}
+
+func newJSONObjectWriter(buf *bytes.Buffer) *jsonObjectWriter {
+	buf.WriteString("{")
+	return &jsonObjectWriter{
+		buf:  buf,
+		seen: make(map[string]bool),
+	}
+}
+
+func (self *jsonObjectWriter) writeValue(key string, value interface{}) {
+	self.writeRaw(key, marshalJSONValue(value))
+}
+
+func (self *jsonObjectWriter) writeRaw(key string, raw []byte) {
+	if self.seen[key] {
+		return
+	}
+	if len(self.seen) > 0 {
+		self.buf.WriteString(",")
+	}
+	self.seen[key] = true
+
+	self.buf.Write(marshalJSONValue(key))
+	self.buf.WriteString(":")
+	self.buf.Write(raw)
+}
+
+func (self *jsonObjectWriter) close() {
+	self.buf.WriteString("}")
+}
+
+// marshalJSONValue() converts any value into JSON
+//
+// values that encoding/json cannot handle are written as strings instead,
+// so that a bad field never costs us the whole log entry
+func marshalJSONValue(value interface{}) []byte {
+	// errors usually marshal as an empty object, which is no use to anyone
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		buf.Reset()
+		encoder.Encode(fmt.Sprintf("%+v", value))
+	}
+
+	// Encode() always adds a trailing newline
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+func sortedStringKeys(data map[string]string) []string {
+	retval := make([]string, 0, len(data))
+	for key := range data {
+		retval = append(retval, key)
+	}
+	sort.Strings(retval)
+
+	return retval
+}
+
+func sortedFieldKeys(fields LogFields) []string {
+	retval := make([]string, 0, len(fields))
+	for key := range fields {
+		retval = append(retval, key)
+	}
+	sort.Strings(retval)
+
+	return retval
+}
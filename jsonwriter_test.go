@@ -0,0 +1,45 @@
+package modlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestJSONOutputWriterWritesWholeEntry(t *testing.T) {
+	var buf bytes.Buffer
+	entry := NewLogEntry(ErrorLevel, "db", "quote \" and newline \n <here>")
+	entry.When = time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry.Data["err"] = errors.New("boom")
+	entry.Data["count"] = 3
+
+	JSONOutputWriter(&buf, entry, map[string]string{FormatFilename: "main.go:12", FormatTimestamp: ""})
+
+	expected := `{"time":"2014-01-02T03:04:05Z","level":"ERROR","module":"db","msg":"quote \" and newline \n <here>","filename":"main.go:12","count":3,"err":"boom"}` + "\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestJSONOutputWriterSupportsCustomKeys(t *testing.T) {
+	var buf bytes.Buffer
+	entry := NewLogEntry(InfoLevel, "", "hello")
+	entry.Data["fn"] = func() {}
+
+	writer := NewJSONOutputWriter(JSONWriterConfig{
+		LevelKey:   "severity",
+		MessageKey: "message",
+		FieldsKey:  "fields",
+	})
+	writer(&buf, entry, nil)
+
+	var decoded map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &decoded)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "INFO", decoded["severity"])
+	assert.Equal(t, "hello", decoded["message"])
+	_, ok := decoded["fields"].(map[string]interface{})["fn"].(string)
+	assert.T(t, ok)
+}
@@ -10,6 +10,25 @@ import (
 // LogFields is arbitrary data attached to a LogEntry
 type LogFields map[string]interface{}
 
+// LogCaller records where in the code a LogEntry was created
+type LogCaller struct {
+	// the full path to the source file
+	File string
+
+	// the line number in the source file
+	Line int
+
+	// the fully-qualified name of the function, as reported by the runtime
+	Function string
+
+	// the import path of the package that the function belongs to
+	Package string
+
+	// the program counter, as returned by runtime.Callers(), for passing
+	// on to the likes of slog.Record; 0 if it is not known
+	PC uintptr
+}
+
 // LogEntry is a single log message that the caller wants to output somewhere
 type LogEntry struct {
 	// what level is this entry for?
@@ -26,6 +45,11 @@ type LogEntry struct {
 
 	// when was the message generated?
 	When time.Time
+
+	// where was the message generated?
+	//
+	// the Logger fills this in, and it is nil if we do not know
+	Caller *LogCaller
 }
 
 // NewLogEntry() creates a new log entry
@@ -0,0 +1,170 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// LogfmtWriterConfig controls the key names and formats used by the output
+// writer that NewLogfmtOutputWriter() creates
+type LogfmtWriterConfig struct {
+	// the keys to write the LogEntry's own fields under
+	//
+	// set any of these to "" to leave that field out
+	TimeKey    string
+	LevelKey   string
+	ModuleKey  string
+	MessageKey string
+
+	// the layout to pass to time.Format() for the TimeKey field
+	TimeFormat string
+}
+
+// DefaultLogfmtWriterConfig is the config used by LogfmtOutputWriter()
+var DefaultLogfmtWriterConfig = LogfmtWriterConfig{
+	TimeKey:    "ts",
+	LevelKey:   "level",
+	ModuleKey:  "module",
+	MessageKey: "msg",
+	TimeFormat: time.RFC3339Nano,
+}
+
+// LogfmtOutputWriter() writes each log entry as a single line of logfmt
+// key=value pairs, using the key names in DefaultLogfmtWriterConfig
+func LogfmtOutputWriter(out io.Writer, entry *LogEntry, data map[string]string) error {
+	return writeLogfmtEntry(out, entry, data, &DefaultLogfmtWriterConfig)
+}
+
+// NewLogfmtOutputWriter() returns a CheckedOutputWriter that writes each log
+// entry as a single line of logfmt key=value pairs, using the given key
+// names
+func NewLogfmtOutputWriter(config LogfmtWriterConfig) CheckedOutputWriter {
+	return func(out io.Writer, entry *LogEntry, data map[string]string) error {
+		return writeLogfmtEntry(out, entry, data, &config)
+	}
+}
+
+func writeLogfmtEntry(out io.Writer, entry *LogEntry, data map[string]string, config *LogfmtWriterConfig) error {
+	buf := new(bytes.Buffer)
+
+	// the LogEntry's own fields always come first
+	if len(config.TimeKey) > 0 {
+		writeLogfmtPair(buf, config.TimeKey, entry.When.Format(config.TimeFormat))
+	}
+	if len(config.LevelKey) > 0 {
+		writeLogfmtPair(buf, config.LevelKey, strings.ToLower(entry.LogLevel.String()))
+	}
+	if len(config.ModuleKey) > 0 && len(entry.Module) > 0 {
+		writeLogfmtPair(buf, config.ModuleKey, entry.Module)
+	}
+	if len(config.MessageKey) > 0 {
+		writeLogfmtPair(buf, config.MessageKey, entry.Message)
+	}
+
+	// then the output from our formatters
+	for _, key := range sortedStringKeys(data) {
+		if len(data[key]) > 0 {
+			writeLogfmtPair(buf, key, data[key])
+		}
+	}
+
+	// and finally any additional information
+	for _, key := range sortedFieldKeys(entry.Data) {
+		writeLogfmtPair(buf, key, logfmtValueString(entry.Data[key]))
+	}
+
+	buf.WriteString("\n")
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+func writeLogfmtPair(buf *bytes.Buffer, key string, value string) {
+	if buf.Len() > 0 {
+		buf.WriteString(" ")
+	}
+	buf.WriteString(logfmtKey(key))
+	buf.WriteString("=")
+	writeLogfmtValue(buf, value)
+}
+
+// logfmtValueString() converts any field value into a string
+func logfmtValueString(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return typed
+	case error:
+		return typed.Error()
+	default:
+		return fmt.Sprint(typed)
+	}
+}
+
+// logfmtKey() makes sure that the key can be parsed back out again
+//
+// logfmt keys cannot be quoted, so we replace anything that would end
+// the key early
+func logfmtKey(key string) string {
+	if len(key) == 0 {
+		return "_"
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// writeLogfmtValue() writes the value, quoting and escaping it if the
+// logfmt conventions require it
+func writeLogfmtValue(buf *bytes.Buffer, value string) {
+	if !logfmtNeedsQuoting(value) {
+		buf.WriteString(value)
+		return
+	}
+
+	buf.WriteString(`"`)
+	for _, r := range value {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < ' ' || r == 0x7f {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteString(`"`)
+}
+
+func logfmtNeedsQuoting(value string) bool {
+	if len(value) == 0 {
+		return true
+	}
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f || r == utf8.RuneError {
+			return true
+		}
+	}
+
+	return false
+}
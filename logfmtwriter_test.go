@@ -0,0 +1,24 @@
+package modlog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestLogfmtOutputWriterQuotesValues(t *testing.T) {
+	var buf bytes.Buffer
+	entry := NewLogEntry(WarnLevel, "http", `said "hi"`+"\n")
+	entry.When = time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry.Data["path"] = "/index.html"
+	entry.Data["empty"] = ""
+	entry.Data["bad key"] = "a=b"
+	entry.Data["nothing"] = nil
+
+	LogfmtOutputWriter(&buf, entry, nil)
+
+	expected := `ts=2014-01-02T03:04:05Z level=warning module=http msg="said \"hi\"\n" bad_key="a=b" empty="" nothing=null path=/index.html` + "\n"
+	assert.Equal(t, expected, buf.String())
+}
@@ -3,6 +3,7 @@
 package modlog
 
 import (
+	"context"
 	"fmt"
 	"io"
 	_ "log"
@@ -23,6 +24,18 @@ type Logger struct {
 	// the different outputs to write to
 	Outputs map[string]*LogOutput
 
+	// the order that our filters and outputs are run in
+	//
+	// use AddFilter(), AddOutput() et al rather than changing the maps
+	// above directly; anything that is only in the maps is run last, in
+	// order of name
+	filterOrder slotOrder
+	outputOrder slotOrder
+
+	// copy request-scoped values out of a context.Context
+	extractors     map[string]ContextExtractor
+	extractorOrder slotOrder
+
 	// StdlibFlags are the flags also supported by the stdlib's log package
 	StdlibFlags int
 
@@ -33,6 +46,18 @@ type Logger struct {
 	// Settings is a generic databag
 	Options *options.OptionsStore
 
+	// exitFunc is called by Fatal(), Fatalf() and Fatalln() once the
+	// message has been logged
+	exitFunc func(int)
+
+	// panicFunc is called by Panic(), Panicf() and Panicln() once the
+	// message has been logged
+	panicFunc func(string)
+
+	// called by Close() before it closes our outputs, e.g. to stop the
+	// background goroutines of our rate limiters
+	closeHooks []func()
+
 	// avoids race conditions
 	mu sync.RWMutex
 }
@@ -52,9 +77,11 @@ func New(out io.Writer, prefix string, flag int) *Logger {
 func NewLogger(logOptions ...LogOption) *Logger {
 	// create a new logger
 	retval := &Logger{
-		Outputs: make(map[string]*LogOutput),
-		Filters: make(map[string]LogFilter),
-		Options: options.NewOptionsStore(optionsWhitelist),
+		Outputs:   make(map[string]*LogOutput),
+		Filters:   make(map[string]LogFilter),
+		Options:   options.NewOptionsStore(optionsWhitelist),
+		exitFunc:  os.Exit,
+		panicFunc: defaultPanicFunc,
 	}
 
 	retval.SetOptions(logOptions...)
@@ -93,21 +120,57 @@ func (self *Logger) SetOptions(logOptions ...LogOption) {
 	}
 }
 
+// AddOutput() creates a new output that writes to out, replacing any
+// existing output that has the same name
+//
+// any output that is replaced is flushed, but is not closed; the new
+// output takes its place in the order that outputs are written to
 func (self *Logger) AddOutput(name string, out io.Writer) *LogOutput {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
-	output := NewLogOutput(out, DefaultOutputWriter)
+	self.outputOrder.addIfMissing(name)
+	return self.addOutput(name, out)
+}
+
+// AddOutputWithPriority() creates a new output that writes to out,
+// replacing any existing output that has the same name
+//
+// outputs are written to in order of priority, lowest first
+func (self *Logger) AddOutputWithPriority(name string, priority int, out io.Writer) *LogOutput {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.outputOrder.add(name, priority)
+	return self.addOutput(name, out)
+}
+
+// addOutput() does the work for AddOutput() and AddOutputWithPriority()
+//
+// the caller must hold our lock
+func (self *Logger) addOutput(name string, out io.Writer) *LogOutput {
+	if old, ok := self.Outputs[name]; ok {
+		old.SetAsync(AsyncOptions{})
+		old.Flush()
+	}
+
+	output := NewLogOutput(out, nil).SetCheckedWriter(DefaultCheckedOutputWriter)
 
 	self.Outputs[name] = output
 	return output
 }
 
+// RemoveOutput() removes the named output, and closes it
 func (self *Logger) RemoveOutput(name string) {
 	self.mu.Lock()
-	defer self.mu.Unlock()
-
+	output, ok := self.Outputs[name]
 	delete(self.Outputs, name)
+	self.outputOrder.remove(name)
+	self.mu.Unlock()
+
+	if ok {
+		output.Close()
+	}
 }
 
 func (self *Logger) GetOutput(name string) *LogOutput {
@@ -118,10 +181,38 @@ func (self *Logger) GetOutput(name string) *LogOutput {
 	return output
 }
 
+// OutputNames() returns the names of our outputs, in the order that they
+// are written to
+func (self *Logger) OutputNames() []string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return append(self.outputOrder.names(), self.outputOrder.strays(self.Outputs)...)
+}
+
+// AddFilter() adds a filter, replacing any existing filter that has the
+// same name
+//
+// a filter that is replaced keeps its place in the order that filters
+// are run in
 func (self *Logger) AddFilter(name string, filter LogFilter) {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
+	self.filterOrder.addIfMissing(name)
+	self.Filters[name] = filter
+}
+
+// AddFilterWithPriority() adds a filter, replacing any existing filter
+// that has the same name
+//
+// filters are run in order of priority, lowest first; put cheap filters
+// first, so that they can reject entries before expensive filters run
+func (self *Logger) AddFilterWithPriority(name string, priority int, filter LogFilter) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.filterOrder.add(name, priority)
 	self.Filters[name] = filter
 }
 
@@ -130,6 +221,16 @@ func (self *Logger) RemoveFilter(name string) {
 	defer self.mu.Unlock()
 
 	delete(self.Filters, name)
+	self.filterOrder.remove(name)
+}
+
+// FilterNames() returns the names of our filters, in the order that they
+// are run in
+func (self *Logger) FilterNames() []string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return append(self.filterOrder.names(), self.filterOrder.strays(self.Filters)...)
 }
 
 func (self *Logger) AddLogEntry(level LogLevel, module string, message string) {
@@ -137,25 +238,215 @@ func (self *Logger) AddLogEntry(level LogLevel, module string, message string) {
 	self.processEntry(entry)
 }
 
-func (self *Logger) processEntry(entry *LogEntry) {
-	self.mu.Lock()
-	defer self.mu.Unlock()
+// processEntry() sends the entry through our filters and out to all of
+// our outputs
+//
+// filters can be called from several goroutines at once, and must be
+// safe for concurrent use
+//
+// it returns the first error reported by any of our outputs
+func (self *Logger) processEntry(entry *LogEntry) error {
+	// where did this entry come from?
+	//
+	// we do this before taking the lock, as it is comparatively expensive
+	if entry.Caller == nil {
+		skip := 0
+		if option, ok := self.Options.Option("callerSkip"); ok {
+			skip = option.(int)
+		}
+		entry.Caller = captureCaller(skip)
+	}
+
+	return self.sendEntry(entry)
+}
+
+// sendEntry() sends the entry through our filters and out to all of our
+// outputs, without working out where it came from
+//
+// use it for entries where the code that is running is not the code that
+// the entry is about (e.g. lines written to an EntryWriter)
+func (self *Logger) sendEntry(entry *LogEntry) error {
+	// a read lock is enough here, so that a slow output doesn't stop
+	// other goroutines from logging too
+	self.mu.RLock()
+	defer self.mu.RUnlock()
 
 	// does this entry pass the filters?
-	for _, filter := range self.Filters {
-		ok := filter(self.Options, entry)
+	ran := 0
+	for _, slot := range self.filterOrder.slots {
+		filter, ok := self.Filters[slot.name]
 		if !ok {
+			continue
+		}
+		ran++
+		if !filter(self.Options, entry) {
 			// we're done
-			return
+			return nil
+		}
+	}
+	if ran < len(self.Filters) {
+		for _, name := range self.filterOrder.strays(self.Filters) {
+			if !self.Filters[name](self.Options, entry) {
+				return nil
+			}
 		}
 	}
 
 	// send this out to all of our outputs
-	for _, output := range self.Outputs {
-		output.ProcessEntry(self, entry)
+	return self.eachOutput(func(output *LogOutput) error {
+		return output.ProcessEntry(self, entry)
+	})
+}
+
+// Flush() waits for entries being written in the background, and then
+// flushes all of our outputs
+//
+// it returns the first error reported by any of our outputs
+func (self *Logger) Flush() error {
+	return self.forEachOutput((*LogOutput).Flush)
+}
+
+// Sync() flushes all of our outputs, and then commits everything written
+// so far to stable storage
+//
+// it returns the first error reported by any of our outputs
+func (self *Logger) Sync() error {
+	return self.forEachOutput((*LogOutput).Sync)
+}
+
+// Close() writes out any pending entries, and then closes all of our
+// outputs
+//
+// it returns the first error reported by any of our outputs
+func (self *Logger) Close() error {
+	self.mu.Lock()
+	hooks := self.closeHooks
+	self.closeHooks = nil
+	self.mu.Unlock()
+
+	// these may still want to log something
+	for _, hook := range hooks {
+		hook()
+	}
+
+	return self.forEachOutput((*LogOutput).Close)
+}
+
+// onClose() arranges for hook to be called the next time that we are
+// closed
+func (self *Logger) onClose(hook func()) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.closeHooks = append(self.closeHooks, hook)
+}
+
+// Shutdown() closes all of our outputs, giving up if the context is done
+// before all pending entries have been written
+func (self *Logger) Shutdown(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- self.Close()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
+// snapshot() returns a copy of the settings that our formatters use, for
+// formatting an entry after our lock has been released
+//
+// the copy has no filters or outputs of its own
+//
+// the caller must hold our lock
+func (self *Logger) snapshot() *Logger {
+	if self == nil {
+		return nil
+	}
+
+	return &Logger{
+		StdlibFlags:  self.StdlibFlags,
+		StdlibPrefix: self.StdlibPrefix,
+		Options:      self.Options,
+	}
+}
+
+// forEachOutput() calls action on each of our outputs, and returns the
+// first error that it reports
+func (self *Logger) forEachOutput(action func(*LogOutput) error) error {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.eachOutput(action)
+}
+
+// eachOutput() does the work for forEachOutput()
+//
+// the caller must hold our lock
+func (self *Logger) eachOutput(action func(*LogOutput) error) error {
+	var retval error
+	record := func(err error) {
+		if err != nil && retval == nil {
+			retval = err
+		}
+	}
+
+	ran := 0
+	for _, slot := range self.outputOrder.slots {
+		output, ok := self.Outputs[slot.name]
+		if !ok {
+			continue
+		}
+		ran++
+		record(action(output))
+	}
+	if ran < len(self.Outputs) {
+		for _, name := range self.outputOrder.strays(self.Outputs) {
+			record(action(self.Outputs[name]))
+		}
+	}
+
+	return retval
+}
+
+// exit() flushes our outputs, and then terminates the program in the
+// same way that the stdlib's log.Fatal() does
+func (self *Logger) exit(code int) {
+	self.Sync()
+
+	self.mu.RLock()
+	exitFunc := self.exitFunc
+	self.mu.RUnlock()
+
+	if exitFunc == nil {
+		exitFunc = os.Exit
+	}
+	exitFunc(code)
+}
+
+// panic() flushes our outputs, and then panics in the same way that the
+// stdlib's log.Panic() does
+func (self *Logger) panic(message string) {
+	self.Sync()
+
+	self.mu.RLock()
+	panicFunc := self.panicFunc
+	self.mu.RUnlock()
+
+	if panicFunc == nil {
+		panicFunc = defaultPanicFunc
+	}
+	panicFunc(message)
+}
+
+func defaultPanicFunc(message string) {
+	panic(message)
+}
+
 func (self *Logger) Tracef(format string, args ...interface{}) {
 	self.AddLogEntry(TraceLevel, "", fmt.Sprintf(format, args...))
 }
@@ -266,26 +557,35 @@ func (self *Logger) Emergencyln(args ...interface{}) {
 
 func (self *Logger) Fatal(args ...interface{}) {
 	self.AddLogEntry(FatalLevel, "", fmt.Sprint(args...))
+	self.exit(1)
 }
 
 func (self *Logger) Fatalf(format string, args ...interface{}) {
 	self.AddLogEntry(FatalLevel, "", fmt.Sprintf(format, args...))
+	self.exit(1)
 }
 
 func (self *Logger) Fatalln(args ...interface{}) {
 	self.AddLogEntry(FatalLevel, "", extrafmt.Sprintnln(args...))
+	self.exit(1)
 }
 
 func (self *Logger) Panic(args ...interface{}) {
-	self.AddLogEntry(PanicLevel, "", fmt.Sprint(args...))
+	message := fmt.Sprint(args...)
+	self.AddLogEntry(PanicLevel, "", message)
+	self.panic(message)
 }
 
 func (self *Logger) Panicf(format string, args ...interface{}) {
-	self.AddLogEntry(PanicLevel, "", fmt.Sprintf(format, args...))
+	message := fmt.Sprintf(format, args...)
+	self.AddLogEntry(PanicLevel, "", message)
+	self.panic(message)
 }
 
 func (self *Logger) Panicln(args ...interface{}) {
-	self.AddLogEntry(PanicLevel, "", extrafmt.Sprintnln(args...))
+	message := extrafmt.Sprintnln(args...)
+	self.AddLogEntry(PanicLevel, "", message)
+	self.panic(message)
 }
 
 func (self *Logger) Print(args ...interface{}) {
@@ -342,8 +642,32 @@ func (self *Logger) SetPrefix(prefix string) {
 	self.StdlibPrefix = prefix
 }
 
+// Output() writes the output for a logging event, at the log level set by
+// SetOutputLogLevel()
+//
+// calldepth is the number of stack frames to skip when working out where
+// the event came from, and 1 means the caller of Output(). It is compatible
+// with the stdlib's log.Output() function
 func (self *Logger) Output(calldepth int, s string) error {
-	return nil
+	return self.output(calldepth+1, s)
+}
+
+func (self *Logger) output(calldepth int, s string) error {
+	// what level do we log at?
+	level := InfoLevel
+	if option, ok := self.Options.Option("outputLogLevel"); ok {
+		level = option.(LogLevel)
+	}
+
+	// the stdlib only adds a newline if there isn't one already
+	if len(s) > 0 && s[len(s)-1] == '\n' {
+		s = s[:len(s)-1]
+	}
+
+	entry := NewLogEntry(level, "", s)
+	entry.Caller = callerAt(calldepth)
+
+	return self.processEntry(entry)
 }
 
 // SetOutput() allows you to set the output to write log messages to
@@ -352,5 +676,5 @@ func (self *Logger) SetOutput(out io.Writer) {
 		AddFormatter(FormatTimestamp, StdlibDateTimeFormatter).
 		AddFormatter(FormatModule, StdlibPrefixFormatter).
 		AddFormatter(FormatFilename, StdlibFileFormatter).
-		SetWriter(StdlibOutputWriter)
+		SetCheckedWriter(StdlibCheckedOutputWriter)
 }
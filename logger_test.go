@@ -1,8 +1,14 @@
 package modlog
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"github.com/bmizerany/assert"
+	"github.com/stuartherbert/go_options"
+	"io"
 	"os"
+	"runtime"
 	"testing"
 )
 
@@ -16,3 +22,174 @@ func TestCanCreateLoggerThatWritesToStderr(t *testing.T) {
 
 	assert.NotEqual(t, a, b)
 }
+
+func TestFatalLogsThenExits(t *testing.T) {
+	var buf bytes.Buffer
+	exitCode := -1
+	l := New(&buf, "", 0)
+	l.SetOptions(SetExitFunc(func(code int) {
+		exitCode = code
+	}))
+
+	l.Fatalf("goodbye %s", "world")
+
+	assert.Equal(t, "goodbye world\n", buf.String())
+	assert.Equal(t, 1, exitCode)
+}
+
+func TestPanicLogsThenPanics(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "", 0)
+
+	defer func() {
+		assert.Equal(t, "goodbye world", recover())
+		assert.Equal(t, "goodbye world\n", buf.String())
+	}()
+	l.Panicln("goodbye", "world")
+	t.Error("Panicln() did not panic")
+}
+
+func TestOutputRecordsCaller(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "", Lshortfile)
+
+	_, _, line, _ := runtime.Caller(0)
+	err := l.Output(1, "hello\n")
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, fmt.Sprintf("logger_test.go:%d: hello\n", line+1), buf.String())
+}
+
+type failingWriter struct{}
+
+func (self failingWriter) Write(p []byte) (int, error) {
+	return 0, os.ErrClosed
+}
+
+func TestOutputReturnsWriteErrors(t *testing.T) {
+	l := New(failingWriter{}, "", 0)
+
+	assert.Equal(t, os.ErrClosed, l.Output(1, "hello"))
+}
+
+func TestOutputWritersWithoutErrorsStillWork(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(SetDefaultOutput(&buf))
+	l.GetOutput("default").SetWriter(DefaultOutputWriter)
+	l.AddOutput("failing", failingWriter{}).SetWriter(StdlibOutputWriter)
+
+	assert.Equal(t, nil, l.Output(1, "hello"))
+	assert.Equal(t, "hello\n", buf.String())
+
+	writer := OutputWriter(DefaultOutputWriter).Checked()
+	assert.Equal(t, nil, writer(failingWriter{}, &LogEntry{Message: "hello"}, nil))
+}
+
+type closingWriter struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (self *closingWriter) Close() error {
+	self.closed = true
+	return nil
+}
+
+func TestRemoveOutputClosesWriter(t *testing.T) {
+	out := &closingWriter{}
+	l := NewLogger()
+	l.AddOutput("closing", out)
+
+	l.RemoveOutput("closing")
+
+	assert.T(t, out.closed)
+	assert.Equal(t, (*LogOutput)(nil), l.GetOutput("closing"))
+}
+
+func TestShutdownWritesPendingEntries(t *testing.T) {
+	out := &closingWriter{}
+	l := NewLogger()
+	l.AddOutput("default", out).SetAsync(AsyncOptions{BufferSize: 10})
+	l.Info("pending")
+
+	err := l.Shutdown(context.Background())
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "pending\n", out.String())
+	assert.T(t, out.closed)
+
+	// closed outputs ignore anything else
+	l.Info("ignored")
+	assert.Equal(t, "pending\n", out.String())
+}
+
+func TestFiltersRunInPriorityOrder(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "", 0)
+	l.SetOptions(SetMinLogLevel(InfoLevel))
+
+	var ran []string
+	record := func(name string, result bool) LogFilter {
+		return func(*options.OptionsStore, *LogEntry) bool {
+			ran = append(ran, name)
+			return result
+		}
+	}
+	l.AddFilter("b", record("b", true))
+	l.AddFilterWithPriority("c", PriorityLast, record("c", true))
+	l.AddFilterWithPriority("a", PriorityFirst, record("a", false))
+
+	assert.Equal(t, []string{LogLevelFilter, "a", "b", "c"}, l.FilterNames())
+
+	// 'a' rejects the entry, so 'b' and 'c' never run
+	l.Info("hello")
+	assert.Equal(t, []string{"a"}, ran)
+	assert.Equal(t, "", buf.String())
+}
+
+func TestOutputsAreWrittenInOrder(t *testing.T) {
+	var order []string
+	l := NewLogger(SetDefaultOutput(&bytes.Buffer{}))
+	for _, name := range []string{"one", "two", "three"} {
+		name := name
+		l.AddOutput(name, &bytes.Buffer{}).SetCheckedWriter(func(io.Writer, *LogEntry, map[string]string) error {
+			order = append(order, name)
+			return nil
+		})
+	}
+	l.RemoveOutput("default")
+
+	// replacing an output keeps its place
+	l.AddOutput("two", &bytes.Buffer{}).SetCheckedWriter(func(io.Writer, *LogEntry, map[string]string) error {
+		order = append(order, "two")
+		return nil
+	})
+
+	l.Info("hello")
+	assert.Equal(t, []string{"one", "two", "three"}, order)
+}
+
+func TestEntriesPutStraightIntoTheMapsStillRun(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "", 0)
+
+	// added without AddFilter() et al, so they run after everything
+	// else, in order of name
+	l.Filters["deny"] = func(store *options.OptionsStore, entry *LogEntry) bool {
+		return entry.Message != "secret"
+	}
+	l.Outputs["z-extra"] = NewLogOutput(&buf, func(out io.Writer, entry *LogEntry, data map[string]string) {
+		io.WriteString(out, "extra: "+data["shout"]+"\n")
+	})
+	l.Outputs["z-extra"].Formatters["shout"] = func(logger *Logger, entry *LogEntry) string {
+		return "[" + entry.Message + "]"
+	}
+
+	assert.Equal(t, []string{"deny"}, l.FilterNames())
+	assert.Equal(t, []string{"default", "z-extra"}, l.OutputNames())
+	assert.Equal(t, []string{"shout"}, l.Outputs["z-extra"].FormatterNames())
+
+	l.Info("secret")
+	l.Info("hello")
+	assert.Equal(t, "hello\nextra: [hello]\n", buf.String())
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"fmt"
+
+	"github.com/stuartherbert/go_extras/extrafmt"
+)
+
+// loggerHandle is the part that FieldLogger and ModuleLogger share: the
+// Logger that entries are sent through, and what to put on every entry
+//
+// the logging methods live here, so that there is only one copy of them
+type loggerHandle struct {
+	// the logger that our entries are sent through
+	logger *Logger
+
+	// the module name to put on every entry
+	module string
+
+	// the data to attach to every entry
+	fields LogFields
+}
+
+// withFields() returns a copy of this handle that attaches our fields
+// plus the given fields to every log entry
+//
+// where the same key appears in both, the new value wins
+func (self *loggerHandle) withFields(fields LogFields) loggerHandle {
+	retval := *self
+	retval.fields = make(LogFields, len(self.fields)+len(fields))
+	for key, value := range self.fields {
+		retval.fields[key] = value
+	}
+	for key, value := range fields {
+		retval.fields[key] = value
+	}
+
+	return retval
+}
+
+// Fields() returns a copy of the fields that we attach to every log entry
+func (self *loggerHandle) Fields() LogFields {
+	retval := make(LogFields, len(self.fields))
+	for key, value := range self.fields {
+		retval[key] = value
+	}
+
+	return retval
+}
+
+func (self *loggerHandle) addLogEntry(level LogLevel, message string) {
+	entry := NewLogEntry(level, self.module, message)
+	for key, value := range self.fields {
+		entry.Data[key] = value
+	}
+	self.logger.processEntry(entry)
+}
+
+func (self *loggerHandle) Tracef(format string, args ...interface{}) {
+	self.addLogEntry(TraceLevel, fmt.Sprintf(format, args...))
+}
+
+func (self *loggerHandle) Trace(args ...interface{}) {
+	self.addLogEntry(TraceLevel, fmt.Sprint(args...))
+}
+
+func (self *loggerHandle) Traceln(args ...interface{}) {
+	self.addLogEntry(TraceLevel, extrafmt.Sprintnln(args...))
+}
+
+func (self *loggerHandle) Debugf(format string, args ...interface{}) {
+	self.addLogEntry(DebugLevel, fmt.Sprintf(format, args...))
+}
+
+func (self *loggerHandle) Debug(args ...interface{}) {
+	self.addLogEntry(DebugLevel, fmt.Sprint(args...))
+}
+
+func (self *loggerHandle) Debugln(args ...interface{}) {
+	self.addLogEntry(DebugLevel, extrafmt.Sprintnln(args...))
+}
+
+func (self *loggerHandle) Infof(format string, args ...interface{}) {
+	self.addLogEntry(InfoLevel, fmt.Sprintf(format, args...))
+}
+
+func (self *loggerHandle) Info(args ...interface{}) {
+	self.addLogEntry(InfoLevel, fmt.Sprint(args...))
+}
+
+func (self *loggerHandle) Infoln(args ...interface{}) {
+	self.addLogEntry(InfoLevel, extrafmt.Sprintnln(args...))
+}
+
+func (self *loggerHandle) Noticef(format string, args ...interface{}) {
+	self.addLogEntry(NoticeLevel, fmt.Sprintf(format, args...))
+}
+
+func (self *loggerHandle) Notice(args ...interface{}) {
+	self.addLogEntry(NoticeLevel, fmt.Sprint(args...))
+}
+
+func (self *loggerHandle) Noticeln(args ...interface{}) {
+	self.addLogEntry(NoticeLevel, extrafmt.Sprintnln(args...))
+}
+
+func (self *loggerHandle) Warnf(format string, args ...interface{}) {
+	self.addLogEntry(WarnLevel, fmt.Sprintf(format, args...))
+}
+
+func (self *loggerHandle) Warn(args ...interface{}) {
+	self.addLogEntry(WarnLevel, fmt.Sprint(args...))
+}
+
+func (self *loggerHandle) Warnln(args ...interface{}) {
+	self.addLogEntry(WarnLevel, extrafmt.Sprintnln(args...))
+}
+
+func (self *loggerHandle) Errorf(format string, args ...interface{}) {
+	self.addLogEntry(ErrorLevel, fmt.Sprintf(format, args...))
+}
+
+func (self *loggerHandle) Error(args ...interface{}) {
+	self.addLogEntry(ErrorLevel, fmt.Sprint(args...))
+}
+
+func (self *loggerHandle) Errorln(args ...interface{}) {
+	self.addLogEntry(ErrorLevel, extrafmt.Sprintnln(args...))
+}
+
+func (self *loggerHandle) Criticalf(format string, args ...interface{}) {
+	self.addLogEntry(CriticalLevel, fmt.Sprintf(format, args...))
+}
+
+func (self *loggerHandle) Critical(args ...interface{}) {
+	self.addLogEntry(CriticalLevel, fmt.Sprint(args...))
+}
+
+func (self *loggerHandle) Criticalln(args ...interface{}) {
+	self.addLogEntry(CriticalLevel, extrafmt.Sprintnln(args...))
+}
+
+func (self *loggerHandle) Alertf(format string, args ...interface{}) {
+	self.addLogEntry(AlertLevel, fmt.Sprintf(format, args...))
+}
+
+func (self *loggerHandle) Alert(args ...interface{}) {
+	self.addLogEntry(AlertLevel, fmt.Sprint(args...))
+}
+
+func (self *loggerHandle) Alertln(args ...interface{}) {
+	self.addLogEntry(AlertLevel, extrafmt.Sprintnln(args...))
+}
+
+func (self *loggerHandle) Emergencyf(format string, args ...interface{}) {
+	self.addLogEntry(EmergencyLevel, fmt.Sprintf(format, args...))
+}
+
+func (self *loggerHandle) Emergency(args ...interface{}) {
+	self.addLogEntry(EmergencyLevel, fmt.Sprint(args...))
+}
+
+func (self *loggerHandle) Emergencyln(args ...interface{}) {
+	self.addLogEntry(EmergencyLevel, extrafmt.Sprintnln(args...))
+}
+
+func (self *loggerHandle) Fatal(args ...interface{}) {
+	self.addLogEntry(FatalLevel, fmt.Sprint(args...))
+	self.logger.exit(1)
+}
+
+func (self *loggerHandle) Fatalf(format string, args ...interface{}) {
+	self.addLogEntry(FatalLevel, fmt.Sprintf(format, args...))
+	self.logger.exit(1)
+}
+
+func (self *loggerHandle) Fatalln(args ...interface{}) {
+	self.addLogEntry(FatalLevel, extrafmt.Sprintnln(args...))
+	self.logger.exit(1)
+}
+
+func (self *loggerHandle) Panic(args ...interface{}) {
+	message := fmt.Sprint(args...)
+	self.addLogEntry(PanicLevel, message)
+	self.logger.panic(message)
+}
+
+func (self *loggerHandle) Panicf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	self.addLogEntry(PanicLevel, message)
+	self.logger.panic(message)
+}
+
+func (self *loggerHandle) Panicln(args ...interface{}) {
+	message := extrafmt.Sprintnln(args...)
+	self.addLogEntry(PanicLevel, message)
+	self.logger.panic(message)
+}
+
+func (self *loggerHandle) Print(args ...interface{}) {
+	self.addLogEntry(InfoLevel, fmt.Sprint(args...))
+}
+
+func (self *loggerHandle) Printf(format string, args ...interface{}) {
+	self.addLogEntry(InfoLevel, fmt.Sprintf(format, args...))
+}
+
+func (self *loggerHandle) Println(args ...interface{}) {
+	self.addLogEntry(InfoLevel, extrafmt.Sprintnln(args...))
+}
+
+func (self *loggerHandle) Write(level LogLevel, args ...interface{}) {
+	self.addLogEntry(level, fmt.Sprint(args...))
+}
+
+func (self *loggerHandle) Writef(level LogLevel, format string, args ...interface{}) {
+	self.addLogEntry(level, fmt.Sprintf(format, args...))
+}
+
+func (self *loggerHandle) Writeln(level LogLevel, args ...interface{}) {
+	self.addLogEntry(level, extrafmt.Sprintnln(args...))
+}
@@ -2,6 +2,11 @@
 // Released under the 3-clause BSD license
 package modlog
 
+import (
+	"fmt"
+	"strings"
+)
+
 // LogLevel is how we represent log levels internally
 type LogLevel uint8
 
@@ -30,6 +35,7 @@ var LogLevels = map[string]LogLevel{
 	"error":     3,
 	"err":       3,
 	"warn":      4,
+	"warning":   4,
 	"notice":    5,
 	"not":       5,
 	"info":      6,
@@ -70,3 +76,15 @@ func (self *LogLevel) String() string {
 func (self *LogLevel) ShortString() string {
 	return LogLevelShortNames[*self]
 }
+
+// ParseLogLevel() converts a name from LogLevels into a LogLevel
+//
+// the name is not case-sensitive
+func ParseLogLevel(name string) (LogLevel, error) {
+	level, ok := LogLevels[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level '%s'", name)
+	}
+
+	return level, nil
+}
@@ -121,24 +121,33 @@ func ModEmergencyln(modName string, args ...interface{}) {
 
 func ModFatalf(modName string, format string, args ...interface{}) {
 	defaultLogger.AddLogEntry(FatalLevel, modName, fmt.Sprintf(format, args...))
+	defaultLogger.exit(1)
 }
 
 func ModFatal(modName string, args ...interface{}) {
 	defaultLogger.AddLogEntry(FatalLevel, modName, fmt.Sprint(args...))
+	defaultLogger.exit(1)
 }
 
 func ModFatalln(modName string, args ...interface{}) {
 	defaultLogger.AddLogEntry(FatalLevel, modName, extrafmt.Sprintnln(args...))
+	defaultLogger.exit(1)
 }
 
 func ModPanicf(modName string, format string, args ...interface{}) {
-	defaultLogger.AddLogEntry(PanicLevel, modName, fmt.Sprintf(format, args...))
+	message := fmt.Sprintf(format, args...)
+	defaultLogger.AddLogEntry(PanicLevel, modName, message)
+	defaultLogger.panic(message)
 }
 
 func ModPanic(modName string, args ...interface{}) {
-	defaultLogger.AddLogEntry(PanicLevel, modName, fmt.Sprint(args...))
+	message := fmt.Sprint(args...)
+	defaultLogger.AddLogEntry(PanicLevel, modName, message)
+	defaultLogger.panic(message)
 }
 
 func ModPanicln(modName string, args ...interface{}) {
-	defaultLogger.AddLogEntry(PanicLevel, modName, extrafmt.Sprintnln(args...))
+	message := extrafmt.Sprintnln(args...)
+	defaultLogger.AddLogEntry(PanicLevel, modName, message)
+	defaultLogger.panic(message)
 }
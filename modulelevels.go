@@ -0,0 +1,129 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AllModules is the module name that sets the log level for any module
+// that has no log level of its own
+const AllModules = "*"
+
+// ModuleLogLevels maps module names onto the minimum log level to log
+// for that module
+//
+// module names are hierarchical, using '.' as the separator: if there is
+// no entry for 'app.db.pool', we use the entry for 'app.db', then 'app',
+// then AllModules
+type ModuleLogLevels map[string]LogLevel
+
+// ParseModuleLogLevels() converts a string such as 'db=debug,http=warn,*=info'
+// into a ModuleLogLevels map
+func ParseModuleLogLevels(spec string) (ModuleLogLevels, error) {
+	retval := make(ModuleLogLevels)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid module log level '%s'; expected module=level", part)
+		}
+
+		module := normaliseModuleName(pair[0])
+		if len(module) == 0 {
+			return nil, fmt.Errorf("invalid module log level '%s'; module name is empty", part)
+		}
+		level, err := ParseLogLevel(pair[1])
+		if err != nil {
+			return nil, err
+		}
+
+		retval[module] = level
+	}
+
+	return retval, nil
+}
+
+// LevelFor() returns the log level that applies to the given module
+//
+// the second return value is false if no level applies at all
+func (self ModuleLogLevels) LevelFor(module string) (LogLevel, bool) {
+	module = normaliseModuleName(module)
+	for len(module) > 0 {
+		level, ok := self[module]
+		if ok {
+			return level, true
+		}
+
+		// move up to the parent module
+		lastDot := strings.LastIndex(module, ".")
+		if lastDot < 0 {
+			break
+		}
+		module = module[:lastDot]
+	}
+
+	level, ok := self[AllModules]
+	return level, ok
+}
+
+// String() converts the map back into the format that
+// ParseModuleLogLevels() accepts
+func (self ModuleLogLevels) String() string {
+	modules := make([]string, 0, len(self))
+	for module := range self {
+		modules = append(modules, module)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return moduleNameLess(modules[i], modules[j])
+	})
+
+	parts := make([]string, 0, len(modules))
+	for _, module := range modules {
+		level := self[module]
+		parts = append(parts, module+"="+strings.ToLower(level.String()))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// copy() returns a copy of the map that is safe to change
+func (self ModuleLogLevels) copy() ModuleLogLevels {
+	retval := make(ModuleLogLevels, len(self)+1)
+	for module, level := range self {
+		retval[module] = level
+	}
+
+	return retval
+}
+
+// normaliseModuleName() strips whitespace, and treats 'app.*' the same as
+// 'app'
+func normaliseModuleName(module string) string {
+	module = strings.TrimSpace(module)
+	if module == AllModules {
+		return module
+	}
+
+	return strings.TrimSuffix(module, ".*")
+}
+
+// moduleNameLess() sorts module names alphabetically, with AllModules
+// at the end
+func moduleNameLess(a, b string) bool {
+	if a == AllModules {
+		return false
+	}
+	if b == AllModules {
+		return true
+	}
+
+	return a < b
+}
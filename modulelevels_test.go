@@ -0,0 +1,62 @@
+package modlog
+
+import (
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestParseModuleLogLevels(t *testing.T) {
+	levels, err := ParseModuleLogLevels("db=debug, http=WARN,app.*=err,*=info")
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ModuleLogLevels{"db": DebugLevel, "http": WarnLevel, "app": ErrorLevel, "*": InfoLevel}, levels)
+	assert.Equal(t, "app=error,db=debug,http=warning,*=info", levels.String())
+}
+
+func TestParseModuleLogLevelsRejectsUnknownLevels(t *testing.T) {
+	_, err := ParseModuleLogLevels("db=loud")
+
+	assert.NotEqual(t, nil, err)
+}
+
+func TestModuleLogLevelsAreHierarchical(t *testing.T) {
+	levels := ModuleLogLevels{"app": WarnLevel, "app.db": DebugLevel}
+
+	level, ok := levels.LevelFor("app.db.pool")
+	assert.T(t, ok)
+	assert.Equal(t, DebugLevel, level)
+
+	level, ok = levels.LevelFor("app.http")
+	assert.T(t, ok)
+	assert.Equal(t, WarnLevel, level)
+
+	_, ok = levels.LevelFor("other")
+	assert.T(t, !ok)
+}
+
+func TestModuleLogLevelsFilterEntries(t *testing.T) {
+	var entries []*LogEntry
+	l := newCapturingLogger(&entries)
+	l.SetOptions(
+		SetMinLogLevel(ErrorLevel),
+		SetModuleLogLevel("app.db", DebugLevel),
+	)
+
+	l.AddLogEntry(DebugLevel, "app.db.pool", "kept")
+	l.AddLogEntry(DebugLevel, "app.http", "dropped")
+	l.AddLogEntry(ErrorLevel, "app.http", "kept")
+
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "app.db.pool", entries[0].Module)
+	assert.Equal(t, "app.http", entries[1].Module)
+}
+
+func TestModuleLogLevelsRoundTrip(t *testing.T) {
+	levels := ModuleLogLevels{"db": WarnLevel, "*": TraceLevel}
+
+	parsed, err := ParseModuleLogLevels(levels.String())
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, levels, parsed)
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+// ModuleLogger is a lightweight handle that writes log entries for a single
+// module to a Logger
+//
+// Use Logger.Module() to create one
+type ModuleLogger struct {
+	loggerHandle
+}
+
+// Module() returns a ModuleLogger that writes log entries for the given
+// module to this logger
+func (self *Logger) Module(name string) *ModuleLogger {
+	return &ModuleLogger{
+		loggerHandle: loggerHandle{
+			logger: self,
+			module: name,
+		},
+	}
+}
+
+// Module() returns a ModuleLogger that writes log entries for the given
+// module, attaching our fields to every entry
+func (self *FieldLogger) Module(name string) *ModuleLogger {
+	retval := &ModuleLogger{loggerHandle: self.loggerHandle}
+	retval.module = name
+
+	return retval
+}
+
+// Module() returns a ModuleLogger for the given sub-module
+//
+// the sub-module's name is our name and the given name, separated by a
+// '.', so that it inherits our per-module log level
+func (self *ModuleLogger) Module(name string) *ModuleLogger {
+	retval := *self
+	if len(self.module) > 0 {
+		retval.module = self.module + "." + name
+	} else {
+		retval.module = name
+	}
+
+	return &retval
+}
+
+// Name() returns the module name that we put on every log entry
+func (self *ModuleLogger) Name() string {
+	return self.module
+}
+
+// Logger() returns the Logger that we write to
+func (self *ModuleLogger) Logger() *Logger {
+	return self.logger
+}
+
+// WithFields() returns a new ModuleLogger that attaches our fields plus
+// the given fields to every log entry
+//
+// where the same key appears in both, the new value wins
+func (self *ModuleLogger) WithFields(fields LogFields) *ModuleLogger {
+	return &ModuleLogger{loggerHandle: self.withFields(fields)}
+}
+
+// WithField() returns a new ModuleLogger that attaches our fields plus
+// the given key/value pair to every log entry
+func (self *ModuleLogger) WithField(key string, value interface{}) *ModuleLogger {
+	return self.WithFields(LogFields{key: value})
+}
@@ -0,0 +1,33 @@
+package modlog
+
+import (
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestModuleLoggerSetsModuleName(t *testing.T) {
+	var entries []*LogEntry
+	l := newCapturingLogger(&entries)
+
+	db := l.Module("app").Module("db")
+	db.Debugf("connected to %s", "primary")
+	db.WithField("table", "users").Warn("slow query")
+
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "app.db", entries[0].Module)
+	assert.Equal(t, "connected to primary", entries[0].Message)
+	assert.Equal(t, DebugLevel, entries[0].LogLevel)
+	assert.Equal(t, "app.db", entries[1].Module)
+	assert.Equal(t, "users", entries[1].Data["table"])
+}
+
+func TestModuleLoggerKeepsFieldLoggerFields(t *testing.T) {
+	var entries []*LogEntry
+	l := newCapturingLogger(&entries)
+
+	l.WithField("requestId", "abc").Module("http").Info("hello")
+
+	assert.Equal(t, "http", entries[0].Module)
+	assert.Equal(t, "abc", entries[0].Data["requestId"])
+}
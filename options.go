@@ -18,6 +18,9 @@ func initOptionsWhitelist() {
 	// setup the list of options that are supported
 	optionsWhitelist = make(options.ValidOptions)
 	optionsWhitelist["minLogLevel"] = "modlog.LogLevel"
+	optionsWhitelist["moduleLogLevels"] = "modlog.ModuleLogLevels"
+	optionsWhitelist["outputLogLevel"] = "modlog.LogLevel"
+	optionsWhitelist["callerSkip"] = "int"
 }
 
 // LogOption is the signature that all logging option functions must match
@@ -62,11 +65,116 @@ func SetMinLogLevel(level LogLevel) LogOption {
 		}
 
 		// add the required filter if needed
-		if level < TraceLevel {
-			self.AddFilter(LogLevelFilter, FilterLogToMinLevel)
-		} else {
-			self.RemoveFilter(LogLevelFilter)
+		self.updateLogLevelFilter()
+		return nil
+	}
+}
+
+// SetModuleLogLevels() tells the logger to filter out log messages using
+// a different log level for each module
+//
+// modules without a level of their own use the level of their parent
+// module, then the AllModules level, and finally the level set by
+// SetMinLogLevel()
+func SetModuleLogLevels(levels ModuleLogLevels) LogOption {
+	return func(self *Logger) error {
+		err := self.Options.SetOption("moduleLogLevels", levels.copy())
+		if err != nil {
+			return err
+		}
+
+		self.updateLogLevelFilter()
+		return nil
+	}
+}
+
+// SetModuleLogLevel() sets the log level for a single module, keeping the
+// levels already set for any other modules
+func SetModuleLogLevel(module string, level LogLevel) LogOption {
+	return func(self *Logger) error {
+		levels := ModuleLogLevels{}
+		if option, ok := self.Options.Option("moduleLogLevels"); ok {
+			levels = option.(ModuleLogLevels)
+		}
+		levels = levels.copy()
+		levels[normaliseModuleName(module)] = level
+
+		err := self.Options.SetOption("moduleLogLevels", levels)
+		if err != nil {
+			return err
 		}
+
+		self.updateLogLevelFilter()
+		return nil
+	}
+}
+
+// updateLogLevelFilter() makes sure that the right filter is installed for
+// the log levels that have been set
+//
+// the filter runs before any others, as it is cheap and rejects most of
+// the entries that get rejected
+func (self *Logger) updateLogLevelFilter() {
+	// per-module levels need the more expensive filter
+	if _, ok := self.Options.Option("moduleLogLevels"); ok {
+		self.AddFilterWithPriority(LogLevelFilter, PriorityFirst, FilterLogToModuleLevel)
+		return
+	}
+
+	option, ok := self.Options.Option("minLogLevel")
+	if ok && option.(LogLevel) < TraceLevel {
+		self.AddFilterWithPriority(LogLevelFilter, PriorityFirst, FilterLogToMinLevel)
+	} else {
+		self.RemoveFilter(LogLevelFilter)
+	}
+}
+
+// SetOutputLogLevel() tells the logger which log level to use for messages
+// that are written via Output()
+//
+// the default is InfoLevel, the same as Print()
+func SetOutputLogLevel(level LogLevel) LogOption {
+	return func(self *Logger) error {
+		return self.Options.SetOption("outputLogLevel", level)
+	}
+}
+
+// SetCallerSkip() tells the logger to skip over the given number of extra
+// stack frames when working out where a log entry came from
+//
+// use this if you wrap the logger in your own functions; alternatively,
+// call Helper() from inside each of your wrapper functions
+func SetCallerSkip(skip int) LogOption {
+	return func(self *Logger) error {
+		return self.Options.SetOption("callerSkip", skip)
+	}
+}
+
+// SetExitFunc() tells the logger what to call after logging a Fatal()
+// message
+//
+// the default is os.Exit(); replace it to stop tests from exiting
+func SetExitFunc(exitFunc func(int)) LogOption {
+	return func(self *Logger) error {
+		self.mu.Lock()
+		defer self.mu.Unlock()
+
+		self.exitFunc = exitFunc
+		return nil
+	}
+}
+
+// SetPanicFunc() tells the logger what to call after logging a Panic()
+// message
+//
+// the default calls panic() with the message; replace it to intercept
+// panics in tests
+func SetPanicFunc(panicFunc func(string)) LogOption {
+	return func(self *Logger) error {
+		self.mu.Lock()
+		defer self.mu.Unlock()
+
+		self.panicFunc = panicFunc
 		return nil
 	}
 }
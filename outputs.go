@@ -6,15 +6,39 @@ import (
 	"bytes"
 	_ "fmt"
 	"io"
+	"os"
 	"sync"
 
 	"github.com/stuartherbert/go_options"
 )
 
 // OutputWriter is the function that does the final writing to the output
+//
+// it cannot report write errors; use a CheckedOutputWriter if you need to
 type OutputWriter func(io.Writer, *LogEntry, map[string]string)
 
+// CheckedOutputWriter is an OutputWriter that returns any error reported
+// by the io.Writer
+//
+// use LogOutput.SetCheckedWriter() to write through one
+type CheckedOutputWriter func(io.Writer, *LogEntry, map[string]string) error
+
+// Checked() returns a CheckedOutputWriter that calls this OutputWriter,
+// and always returns nil
+func (self OutputWriter) Checked() CheckedOutputWriter {
+	return func(out io.Writer, entry *LogEntry, data map[string]string) error {
+		self(out, entry, data)
+		return nil
+	}
+}
+
 func DefaultOutputWriter(out io.Writer, entry *LogEntry, data map[string]string) {
+	DefaultCheckedOutputWriter(out, entry, data)
+}
+
+// DefaultCheckedOutputWriter() is DefaultOutputWriter(), but it returns
+// any error reported by the io.Writer
+func DefaultCheckedOutputWriter(out io.Writer, entry *LogEntry, data map[string]string) error {
 	//fmt.Printf("(default) data: %+v\n", data)
 	buf := new(bytes.Buffer)
 
@@ -36,10 +60,17 @@ func DefaultOutputWriter(out io.Writer, entry *LogEntry, data map[string]string)
 	}
 	buf.WriteString(entry.Message)
 	buf.WriteString("\n")
-	out.Write(buf.Bytes())
+	_, err := out.Write(buf.Bytes())
+	return err
 }
 
 func StdlibOutputWriter(out io.Writer, entry *LogEntry, data map[string]string) {
+	StdlibCheckedOutputWriter(out, entry, data)
+}
+
+// StdlibCheckedOutputWriter() is StdlibOutputWriter(), but it returns any
+// error reported by the io.Writer
+func StdlibCheckedOutputWriter(out io.Writer, entry *LogEntry, data map[string]string) error {
 	//fmt.Printf("(stdlib) data: %+v\n", data)
 	buf := new(bytes.Buffer)
 
@@ -56,7 +87,8 @@ func StdlibOutputWriter(out io.Writer, entry *LogEntry, data map[string]string)
 	}
 	buf.WriteString(entry.Message)
 	buf.WriteString("\n")
-	out.Write(buf.Bytes())
+	_, err := out.Write(buf.Bytes())
+	return err
 }
 
 // LogOutput represents a single log destination
@@ -67,6 +99,32 @@ type LogOutput struct {
 	mu         sync.Mutex
 	Writer     OutputWriter
 	Options    *options.OptionsStore
+
+	// used instead of Writer when Writer is nil
+	CheckedWriter CheckedOutputWriter
+
+	// used when we are writing from a background goroutine
+	queue   *asyncQueue
+	queueMu sync.RWMutex
+
+	// entries dropped, and entries that could not be written, by
+	// previous queues
+	dropped uint64
+	failed  uint64
+
+	// set once Close() has been called
+	closed bool
+
+	// the order that our filters and formatters are run in
+	//
+	// use AddFilter(), AddFormatter() et al rather than changing the maps
+	// above directly; anything that is only in the maps is run last, in
+	// order of name
+	filterOrder    slotOrder
+	formatterOrder slotOrder
+
+	// set by SuppressDuplicates()
+	duplicates *duplicateTracker
 }
 
 // NewLogOutput() creates a new LogOutput
@@ -82,10 +140,30 @@ func NewLogOutput(out io.Writer, writer OutputWriter) *LogOutput {
 	return retval
 }
 
+// AddFilter() adds a filter, replacing any existing filter that has the
+// same name
+//
+// a filter that is replaced keeps its place in the order that filters
+// are run in
 func (self *LogOutput) AddFilter(name string, filter LogFilter) *LogOutput {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
+	self.filterOrder.addIfMissing(name)
+	self.Filters[name] = filter
+
+	return self
+}
+
+// AddFilterWithPriority() adds a filter, replacing any existing filter
+// that has the same name
+//
+// filters are run in order of priority, lowest first
+func (self *LogOutput) AddFilterWithPriority(name string, priority int, filter LogFilter) *LogOutput {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.filterOrder.add(name, priority)
 	self.Filters[name] = filter
 
 	return self
@@ -96,14 +174,44 @@ func (self *LogOutput) RemoveFilter(name string) *LogOutput {
 	defer self.mu.Unlock()
 
 	delete(self.Filters, name)
+	self.filterOrder.remove(name)
 
 	return self
 }
 
+// FilterNames() returns the names of our filters, in the order that they
+// are run in
+func (self *LogOutput) FilterNames() []string {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return append(self.filterOrder.names(), self.filterOrder.strays(self.Filters)...)
+}
+
+// AddFormatter() adds a formatter, replacing any existing formatter that
+// has the same name
+//
+// a formatter that is replaced keeps its place in the order that
+// formatters are run in
 func (self *LogOutput) AddFormatter(name string, formatter LogFormatter) *LogOutput {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
+	self.formatterOrder.addIfMissing(name)
+	self.Formatters[name] = formatter
+
+	return self
+}
+
+// AddFormatterWithPriority() adds a formatter, replacing any existing
+// formatter that has the same name
+//
+// formatters are run in order of priority, lowest first
+func (self *LogOutput) AddFormatterWithPriority(name string, priority int, formatter LogFormatter) *LogOutput {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.formatterOrder.add(name, priority)
 	self.Formatters[name] = formatter
 
 	return self
@@ -114,35 +222,235 @@ func (self *LogOutput) RemoveFormatter(name string) *LogOutput {
 	defer self.mu.Unlock()
 
 	delete(self.Formatters, name)
+	self.formatterOrder.remove(name)
 
 	return self
 }
 
+// FormatterNames() returns the names of our formatters, in the order that
+// they are run in
+func (self *LogOutput) FormatterNames() []string {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return append(self.formatterOrder.names(), self.formatterOrder.strays(self.Formatters)...)
+}
+
 func (self *LogOutput) SetWriter(writer OutputWriter) *LogOutput {
 	self.Writer = writer
+	self.CheckedWriter = nil
 	return self
 }
 
-func (self *LogOutput) ProcessEntry(logger *Logger, entry *LogEntry) {
+// SetCheckedWriter() sets the writer that does the final writing to our
+// io.Writer, replacing any writer set by SetWriter()
+//
+// unlike an OutputWriter, its errors are returned by ProcessEntry()
+func (self *LogOutput) SetCheckedWriter(writer CheckedOutputWriter) *LogOutput {
+	self.Writer = nil
+	self.CheckedWriter = writer
+	return self
+}
+
+// Flush() waits for any entries being written in the background, and then
+// pushes any data buffered by our io.Writer through to its destination
+//
+// our io.Writer is flushed if it has a Flush() method, such as a
+// bufio.Writer does
+func (self *LogOutput) Flush() error {
+	// wait for the background goroutine to catch up
+	if queue := self.currentQueue(); queue != nil {
+		queue.flush()
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	// don't leave a repeat count waiting for its timeout
+	err := self.writeRepeats()
+
+	if flusher, ok := self.Out.(interface {
+		Flush() error
+	}); ok {
+		flushErr := flusher.Flush()
+		if err == nil {
+			err = flushErr
+		}
+	}
+
+	return err
+}
+
+// Sync() flushes this output, and then commits everything written so far
+// to stable storage, if our io.Writer has a Sync() method such as an
+// *os.File does
+func (self *LogOutput) Sync() error {
+	err := self.Flush()
+	if err != nil {
+		return err
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	// syncing a terminal or a pipe is an error, which is no use to anyone
+	if isStdStream(self.Out) {
+		return nil
+	}
+	if syncer, ok := self.Out.(interface {
+		Sync() error
+	}); ok {
+		return syncer.Sync()
+	}
+
+	return nil
+}
+
+// Close() writes out any pending entries, and then closes our io.Writer
+// if it is an io.Closer
+//
+// os.Stdout and os.Stderr are never closed. Once closed, the output
+// ignores any further log entries
+func (self *LogOutput) Close() error {
+	// stop the background goroutine, if there is one
+	self.SetAsync(AsyncOptions{})
+
+	err := self.Flush()
+
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
+	if self.closed {
+		return err
+	}
+	self.closed = true
+
+	if closer, ok := self.Out.(io.Closer); ok && !isStdStream(self.Out) {
+		closeErr := closer.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// isStdStream() returns true if out is the process's stdout or stderr
+func isStdStream(out io.Writer) bool {
+	return out == os.Stdout || out == os.Stderr
+}
+
+// ProcessEntry() filters, formats and writes a single log entry
+//
+// it returns any error reported when writing the entry; asynchronous
+// outputs always return nil
+func (self *LogOutput) ProcessEntry(logger *Logger, entry *LogEntry) error {
 	// does the log entry pass our filters?
-	for _, filter := range self.Filters {
-		ok := filter(self.Options, entry)
+	if !self.passesFilters(entry) {
+		return nil
+	}
+
+	// are we writing from the background?
+	//
+	// we must not hold queueMu while we wait for room in the queue
+	for queue := self.currentQueue(); queue != nil; queue = self.currentQueue() {
+		if queue.push(asyncItem{logger: logger.snapshot(), entry: entry}) {
+			return nil
+		}
+		// SetAsync() stopped the queue before we could push to it
+	}
+
+	return self.writeEntry(logger, entry)
+}
+
+// currentQueue() returns the queue that our background goroutine reads
+// from, or nil if we are synchronous
+func (self *LogOutput) currentQueue() *asyncQueue {
+	self.queueMu.RLock()
+	defer self.queueMu.RUnlock()
+
+	return self.queue
+}
+
+// passesFilters() returns true if the entry passes all of our filters
+func (self *LogOutput) passesFilters(entry *LogEntry) bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	ran := 0
+	for _, slot := range self.filterOrder.slots {
+		filter, ok := self.Filters[slot.name]
 		if !ok {
-			// we're done here
-			return
+			continue
+		}
+		ran++
+		if !filter(self.Options, entry) {
+			return false
+		}
+	}
+	if ran < len(self.Filters) {
+		for _, name := range self.filterOrder.strays(self.Filters) {
+			if !self.Filters[name](self.Options, entry) {
+				return false
+			}
 		}
 	}
 
+	return true
+}
+
+// writeEntry() formats the entry, and writes it to our io.Writer
+func (self *LogOutput) writeEntry(logger *Logger, entry *LogEntry) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.closed {
+		return nil
+	}
+
+	// are we collapsing repeated entries?
+	if self.duplicates == nil {
+		return self.formatAndWrite(logger, entry)
+	}
+	if self.isRepeat(entry) {
+		return nil
+	}
+	err := self.writeRepeats()
+	self.rememberEntry(logger, entry)
+
+	writeErr := self.formatAndWrite(logger, entry)
+	if err == nil {
+		err = writeErr
+	}
+
+	return err
+}
+
+// formatAndWrite() runs the entry through our formatters, and then writes
+// it to our io.Writer
+//
+// the caller must hold our lock
+func (self *LogOutput) formatAndWrite(logger *Logger, entry *LogEntry) error {
 	// run things through our formatters to create the extra fields that
 	// are wanted
 	data := make(map[string]string)
-	for name, formatter := range self.Formatters {
-		data[name] = formatter(logger, entry)
+	for _, slot := range self.formatterOrder.slots {
+		formatter, ok := self.Formatters[slot.name]
+		if !ok {
+			continue
+		}
+		data[slot.name] = formatter(logger, entry)
+	}
+	if len(data) < len(self.Formatters) {
+		for _, name := range self.formatterOrder.strays(self.Formatters) {
+			data[name] = self.Formatters[name](logger, entry)
+		}
 	}
 
 	// now we need to write the output
-	self.Writer(self.Out, entry, data)
+	if self.Writer != nil {
+		self.Writer(self.Out, entry, data)
+		return nil
+	}
+	return self.CheckedWriter(self.Out, entry, data)
 }
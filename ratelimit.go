@@ -0,0 +1,301 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/stuartherbert/go_options"
+)
+
+// EntryKeyFunc decides which log entries count as similar to each other
+//
+// entries that return the same key are treated as similar; entries that
+// return an empty key are not similar to anything, and are never limited
+// or sampled
+type EntryKeyFunc func(*LogEntry) string
+
+// KeyByCallSite() treats entries that were logged from the same line of
+// code as similar
+//
+// entries with no known caller are grouped by module and message instead
+func KeyByCallSite(entry *LogEntry) string {
+	if entry.Caller == nil {
+		return KeyByMessage(entry)
+	}
+
+	return entry.Caller.File + ":" + strconv.Itoa(entry.Caller.Line)
+}
+
+// KeyByMessage() treats entries that have the same module and message as
+// similar
+func KeyByMessage(entry *LogEntry) string {
+	return entry.Module + "\x00" + entry.Message
+}
+
+// KeyByField() returns an EntryKeyFunc that treats entries with the same
+// value in the named LogEntry.Data field as similar
+//
+// entries that do not have the field are left alone
+func KeyByField(name string) EntryKeyFunc {
+	return func(entry *LogEntry) string {
+		value, ok := entry.Data[name]
+		if !ok {
+			return ""
+		}
+
+		return fmt.Sprint(value)
+	}
+}
+
+// RateLimitOptions controls how a RateLimiter behaves
+//
+// each key gets a token bucket that holds up to Burst tokens, and that
+// gains one token every Every; each entry uses up one token, and entries
+// that arrive when the bucket is empty are suppressed
+type RateLimitOptions struct {
+	// decides which entries share a bucket; defaults to KeyByCallSite
+	Key EntryKeyFunc
+
+	// how many entries can be logged in a row; defaults to 10
+	Burst int
+
+	// how often a bucket gains a token; defaults to time.Second
+	Every time.Duration
+
+	// how often we log a summary of what we have suppressed; defaults to
+	// one minute
+	SummaryInterval time.Duration
+
+	// the most keys that we track at once; entries for any other keys are
+	// not rate-limited until we have room again. Defaults to 10000
+	MaxKeys int
+}
+
+// RateLimiter is a filter that stops similar entries from flooding the
+// log, and which logs a summary of what it has suppressed
+type RateLimiter struct {
+	logger  *Logger
+	options RateLimitOptions
+
+	buckets map[string]*rateLimitBucket
+
+	// the summary entries that we are logging, so that we don't filter
+	// them out
+	summaries sync.Map
+
+	// allows the tests to control time
+	now func() time.Time
+
+	// when we last logged our summaries, or were created
+	lastSummary time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	mu sync.Mutex
+}
+
+// rateLimitBucket tracks a single key
+type rateLimitBucket struct {
+	tokens float64
+	last   time.Time
+
+	// what we have suppressed since our last summary
+	suppressed uint64
+	level      LogLevel
+	module     string
+	message    string
+	caller     *LogCaller
+}
+
+// NewRateLimiter() creates a new RateLimiter, which logs its summaries to
+// the given logger
+//
+// call Stop() once you no longer need the RateLimiter; it is stopped for
+// you when the logger is closed
+func NewRateLimiter(logger *Logger, options RateLimitOptions) *RateLimiter {
+	if options.Key == nil {
+		options.Key = KeyByCallSite
+	}
+	if options.Burst <= 0 {
+		options.Burst = 10
+	}
+	if options.Every <= 0 {
+		options.Every = time.Second
+	}
+	if options.SummaryInterval <= 0 {
+		options.SummaryInterval = time.Minute
+	}
+	if options.MaxKeys <= 0 {
+		options.MaxKeys = 10000
+	}
+
+	retval := &RateLimiter{
+		logger:      logger,
+		options:     options,
+		buckets:     make(map[string]*rateLimitBucket),
+		now:         time.Now,
+		lastSummary: time.Now(),
+		stop:        make(chan struct{}),
+	}
+
+	retval.wg.Add(1)
+	go retval.run()
+	logger.onClose(retval.Stop)
+
+	return retval
+}
+
+// AddRateLimitFilter() creates a new RateLimiter, and adds it to our
+// filters under the given name
+func (self *Logger) AddRateLimitFilter(name string, options RateLimitOptions) *RateLimiter {
+	retval := NewRateLimiter(self, options)
+	self.AddFilter(name, retval.Filter)
+
+	return retval
+}
+
+// Filter() is a LogFilter that returns false for any entry that has
+// exceeded its rate limit
+func (self *RateLimiter) Filter(os *options.OptionsStore, entry *LogEntry) bool {
+	// never suppress our own summaries
+	if _, ok := self.summaries.Load(entry); ok {
+		return true
+	}
+
+	key := self.options.Key(entry)
+	if len(key) == 0 {
+		return true
+	}
+	now := self.now()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	bucket, ok := self.buckets[key]
+	if !ok {
+		if len(self.buckets) >= self.options.MaxKeys {
+			return true
+		}
+		bucket = &rateLimitBucket{
+			tokens: float64(self.options.Burst),
+			last:   now,
+		}
+		self.buckets[key] = bucket
+	}
+
+	// top up the bucket
+	bucket.tokens += float64(now.Sub(bucket.last)) / float64(self.options.Every)
+	if bucket.tokens > float64(self.options.Burst) {
+		bucket.tokens = float64(self.options.Burst)
+	}
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true
+	}
+
+	// remember enough to write a useful summary
+	if bucket.suppressed == 0 || entry.LogLevel < bucket.level {
+		bucket.level = entry.LogLevel
+	}
+	bucket.suppressed++
+	bucket.module = entry.Module
+	bucket.message = entry.Message
+	bucket.caller = entry.Caller
+
+	return false
+}
+
+// Stop() logs a final summary, and stops the background goroutine that
+// logs our summaries
+//
+// it does not remove us from the logger's filters
+func (self *RateLimiter) Stop() {
+	self.stopOnce.Do(func() {
+		close(self.stop)
+	})
+	self.wg.Wait()
+}
+
+// run() logs a summary every SummaryInterval, until we are stopped
+func (self *RateLimiter) run() {
+	defer self.wg.Done()
+
+	ticker := time.NewTicker(self.options.SummaryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			self.logSummaries()
+		case <-self.stop:
+			self.logSummaries()
+			return
+		}
+	}
+}
+
+// logSummaries() logs a summary for every key that has had entries
+// suppressed, and forgets about keys that have gone quiet
+func (self *RateLimiter) logSummaries() {
+	now := self.now()
+	var summaries []*LogEntry
+
+	self.mu.Lock()
+
+	// Stop() does not wait for a whole SummaryInterval
+	period := now.Sub(self.lastSummary)
+	self.lastSummary = now
+
+	for key, bucket := range self.buckets {
+		if bucket.suppressed > 0 {
+			summaries = append(summaries, self.newSummary(bucket, period))
+			bucket.suppressed = 0
+			continue
+		}
+
+		// a bucket that would be full again is no different to a new one
+		idle := now.Sub(bucket.last)
+		if bucket.tokens+float64(idle)/float64(self.options.Every) >= float64(self.options.Burst) {
+			delete(self.buckets, key)
+		}
+	}
+	self.mu.Unlock()
+
+	// we log these without holding our lock, as our Filter() will be
+	// called for each of them
+	for _, entry := range summaries {
+		self.summaries.Store(entry, true)
+		self.logger.processEntry(entry)
+		self.summaries.Delete(entry)
+	}
+}
+
+// newSummary() creates the entry that tells everyone what we have
+// suppressed from the given bucket during the last 'period'
+func (self *RateLimiter) newSummary(bucket *rateLimitBucket, period time.Duration) *LogEntry {
+	noun := "messages"
+	if bucket.suppressed == 1 {
+		noun = "message"
+	}
+	message := fmt.Sprintf(
+		"suppressed %d similar %s in the last %gs",
+		bucket.suppressed,
+		noun,
+		period.Round(time.Millisecond).Seconds(),
+	)
+
+	retval := NewLogEntry(bucket.level, bucket.module, message)
+	retval.Data["suppressed"] = bucket.suppressed
+	retval.Data["similar_to"] = bucket.message
+	retval.Caller = bucket.caller
+
+	return retval
+}
@@ -0,0 +1,109 @@
+package modlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestRateLimiterSuppressesThenSummarises(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+
+	now := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	limiter := logger.AddRateLimitFilter("ratelimit", RateLimitOptions{
+		Key:             KeyByMessage,
+		Burst:           2,
+		Every:           time.Second,
+		SummaryInterval: time.Hour,
+	})
+	limiter.now = func() time.Time { return now }
+	limiter.lastSummary = now
+
+	for i := 0; i < 5; i++ {
+		logger.Error("retrying")
+	}
+	logger.Error("something else")
+	assert.Equal(t, 3, len(entries))
+
+	// the bucket refills over time
+	now = now.Add(time.Second)
+	logger.Error("retrying")
+	logger.Error("retrying")
+	assert.Equal(t, 4, len(entries))
+
+	limiter.Stop()
+	assert.Equal(t, 5, len(entries))
+	assert.Equal(t, "suppressed 4 similar messages in the last 1s", entries[4].Message)
+	assert.Equal(t, ErrorLevel, entries[4].LogLevel)
+	assert.Equal(t, uint64(4), entries[4].Data["suppressed"])
+	assert.Equal(t, "retrying", entries[4].Data["similar_to"])
+}
+
+func TestKeyByFieldGroupsEntriesByValue(t *testing.T) {
+	key := KeyByField("host")
+	a := NewLogEntry(InfoLevel, "", "one")
+	a.Data["host"] = "db1"
+	b := NewLogEntry(InfoLevel, "", "two")
+	b.Data["host"] = "db1"
+
+	assert.Equal(t, key(a), key(b))
+	assert.NotEqual(t, key(a), key(NewLogEntry(InfoLevel, "", "one")))
+}
+
+func TestRateLimiterIgnoresEntriesWithoutTheKeyField(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+
+	limiter := logger.AddRateLimitFilter("ratelimit", RateLimitOptions{
+		Key:             KeyByField("host"),
+		Burst:           2,
+		SummaryInterval: time.Hour,
+	})
+	defer limiter.Stop()
+
+	// none of these have a 'host', so they are unrelated
+	logger.Info("a")
+	logger.Warn("b")
+	logger.Error("c")
+	logger.Info("d")
+	assert.Equal(t, 4, len(entries))
+
+	// but these do
+	for i := 0; i < 3; i++ {
+		logger.WithField("host", "db1").Error("unreachable")
+	}
+	assert.Equal(t, 6, len(entries))
+}
+
+func TestClosingTheLoggerStopsItsRateLimiters(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+	limiter := logger.AddRateLimitFilter("ratelimit", RateLimitOptions{
+		Key:             KeyByMessage,
+		Burst:           1,
+		SummaryInterval: time.Hour,
+	})
+	now := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	limiter.lastSummary = now
+
+	logger.Error("retrying")
+	logger.Error("retrying")
+
+	// the summary covers the time since the last one, not a whole
+	// SummaryInterval
+	now = now.Add(30 * time.Second)
+	logger.Close()
+
+	// the summary was logged before the outputs were closed
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "suppressed 1 similar message in the last 30s", entries[1].Message)
+
+	select {
+	case <-limiter.stop:
+	default:
+		t.Error("rate limiter is still running")
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// ReopenOptions controls how a ReopenableFile is opened and checked
+type ReopenOptions struct {
+	// the permissions to create the log file with; defaults to 0644
+	FileMode os.FileMode
+
+	// if set, we check this often (while writing) whether the file has
+	// been moved or deleted, and reopen it if it has
+	//
+	// set this to 0 to only reopen when Reopen() is called
+	CheckInterval time.Duration
+}
+
+// Reopener is implemented by any io.Writer that can reopen its underlying
+// file, e.g. after logrotate has moved it out of the way
+type Reopener interface {
+	Reopen() error
+}
+
+// ReopenableFile is an io.Writer that writes to a file on disk, and which
+// can reopen that file when an external tool such as logrotate moves it
+type ReopenableFile struct {
+	path    string
+	options ReopenOptions
+
+	// the file that we are currently writing to
+	file *os.File
+
+	// when we last checked whether our file has been moved
+	lastCheck time.Time
+
+	mu sync.Mutex
+}
+
+// OpenReopenableFile() opens the file at path for appending, creating it
+// if it does not exist
+func OpenReopenableFile(path string, options ReopenOptions) (*ReopenableFile, error) {
+	if options.FileMode == 0 {
+		options.FileMode = 0644
+	}
+
+	retval := &ReopenableFile{
+		path:    path,
+		options: options,
+	}
+
+	file, err := retval.open()
+	if err != nil {
+		return nil, err
+	}
+	retval.file = file
+
+	return retval, nil
+}
+
+// AddReopenableFileOutput() creates a new output that writes to a
+// ReopenableFile at the given path
+func (self *Logger) AddReopenableFileOutput(name string, path string, options ReopenOptions) (*LogOutput, error) {
+	file, err := OpenReopenableFile(path, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.AddOutput(name, file), nil
+}
+
+// Path() returns the path of the file that we write to
+func (self *ReopenableFile) Path() string {
+	return self.path
+}
+
+// Write() writes to the current file
+func (self *ReopenableFile) Write(p []byte) (int, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	// has our file been moved since we last looked?
+	if self.options.CheckInterval > 0 && time.Since(self.lastCheck) >= self.options.CheckInterval {
+		self.lastCheck = time.Now()
+
+		// if we cannot reopen, we keep writing to the old file rather than
+		// lose the entry
+		self.reopenIfMoved()
+	}
+
+	return self.file.Write(p)
+}
+
+// Reopen() reopens our path, if the file there is no longer the file
+// that we are writing to
+func (self *ReopenableFile) Reopen() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.file == nil {
+		return os.ErrClosed
+	}
+
+	return self.reopenIfMoved()
+}
+
+// Sync() commits the current file to stable storage
+func (self *ReopenableFile) Sync() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.file == nil {
+		return os.ErrClosed
+	}
+
+	return self.file.Sync()
+}
+
+// Close() closes the current file
+func (self *ReopenableFile) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.file == nil {
+		return os.ErrClosed
+	}
+
+	err := self.file.Close()
+	self.file = nil
+
+	return err
+}
+
+func (self *ReopenableFile) open() (*os.File, error) {
+	return os.OpenFile(self.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, self.options.FileMode)
+}
+
+// reopenIfMoved() compares the inode at our path with the file that we
+// have open, and reopens our path if they are different
+//
+// the caller must hold our lock
+func (self *ReopenableFile) reopenIfMoved() error {
+	current, err := self.file.Stat()
+	if err == nil {
+		onDisk, err := os.Stat(self.path)
+		if err == nil && os.SameFile(current, onDisk) {
+			// nothing to do
+			return nil
+		}
+	}
+
+	// we open the new file before closing the old one, so that there is
+	// never a moment where we cannot write
+	file, err := self.open()
+	if err != nil {
+		return err
+	}
+	old := self.file
+	self.file = file
+
+	return old.Close()
+}
+
+// Reopen() asks every output that can reopen its file to do so
+//
+// it returns the first error reported by any of our outputs
+func (self *Logger) Reopen() error {
+	return self.forEachOutput(func(output *LogOutput) error {
+		// make sure nothing is left behind in the old file
+		output.Flush()
+
+		output.mu.Lock()
+		defer output.mu.Unlock()
+
+		if reopener, ok := output.Out.(Reopener); ok {
+			return reopener.Reopen()
+		}
+		return nil
+	})
+}
+
+// allows the tests to see which signals ReopenOnSignal() listens for
+var (
+	signalNotify = signal.Notify
+	signalStop   = signal.Stop
+)
+
+// ReopenOnSignal() calls Reopen() every time the process receives one of
+// the given signals; the default is SIGHUP
+//
+// on platforms that have no SIGHUP, such as Windows and js/wasm, there is
+// no default, and it does nothing unless you pass in some signals
+//
+// call the returned function to stop listening for the signals
+func (self *Logger) ReopenOnSignal(signals ...os.Signal) func() {
+	if len(signals) == 0 {
+		signals = defaultReopenSignals
+	}
+	if len(signals) == 0 {
+		// signal.Notify() would give us every signal instead
+		return func() {}
+	}
+
+	received := make(chan os.Signal, 1)
+	stop := make(chan struct{})
+	signalNotify(received, signals...)
+
+	go func() {
+		for {
+			select {
+			case <-received:
+				err := self.Reopen()
+				if err != nil {
+					self.Errorf("unable to reopen log files; error is: %s", err.Error())
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signalStop(received)
+			close(stop)
+		})
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+
+//go:build !unix
+// +build !unix
+
+package modlog
+
+import (
+	"os"
+)
+
+// the signals that ReopenOnSignal() listens for when it is not given any;
+// there is no SIGHUP here, so there are none
+var defaultReopenSignals []os.Signal
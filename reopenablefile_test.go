@@ -0,0 +1,86 @@
+package modlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestReopenableFileReopensAfterItIsMoved(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	file, err := OpenReopenableFile(path, ReopenOptions{})
+	assert.Equal(t, nil, err)
+
+	file.Write([]byte("one\n"))
+	assert.Equal(t, nil, os.Rename(path, path+".1"))
+
+	// until we reopen, we keep writing to the moved file
+	file.Write([]byte("two\n"))
+	assert.Equal(t, nil, file.Reopen())
+	file.Write([]byte("three\n"))
+	assert.Equal(t, nil, file.Close())
+
+	moved, _ := os.ReadFile(path + ".1")
+	assert.Equal(t, "one\ntwo\n", string(moved))
+	current, _ := os.ReadFile(path)
+	assert.Equal(t, "three\n", string(current))
+}
+
+func TestReopenableFileLeavesAnUnmovedFileAlone(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	file, err := OpenReopenableFile(path, ReopenOptions{})
+	assert.Equal(t, nil, err)
+	before := file.file
+
+	assert.Equal(t, nil, file.Reopen())
+	assert.Equal(t, before, file.file)
+	assert.Equal(t, nil, file.Close())
+	assert.Equal(t, os.ErrClosed, file.Reopen())
+}
+
+func TestLoggerReopenReopensItsFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	l := NewLogger()
+	_, err := l.AddReopenableFileOutput("default", path, ReopenOptions{})
+	assert.Equal(t, nil, err)
+
+	l.Info("one")
+	assert.Equal(t, nil, os.Rename(path, path+".1"))
+	l.Info("two")
+	assert.Equal(t, nil, l.Reopen())
+	l.Info("three")
+	assert.Equal(t, nil, l.Close())
+
+	moved, _ := os.ReadFile(path + ".1")
+	assert.Equal(t, "one\ntwo\n", string(moved))
+	current, _ := os.ReadFile(path)
+	assert.Equal(t, "three\n", string(current))
+}
+
+func TestReopenableFileChecksWhetherItHasBeenMoved(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	file, err := OpenReopenableFile(path, ReopenOptions{CheckInterval: time.Nanosecond})
+	assert.Equal(t, nil, err)
+
+	file.Write([]byte("one\n"))
+	assert.Equal(t, nil, os.Rename(path, path+".1"))
+	time.Sleep(time.Millisecond)
+	file.Write([]byte("two\n"))
+	assert.Equal(t, nil, file.Close())
+
+	moved, _ := os.ReadFile(path + ".1")
+	assert.Equal(t, "one\n", string(moved))
+	current, _ := os.ReadFile(path)
+	assert.Equal(t, "two\n", string(current))
+}
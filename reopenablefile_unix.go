@@ -0,0 +1,16 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+
+//go:build unix
+// +build unix
+
+package modlog
+
+import (
+	"os"
+	"syscall"
+)
+
+// the signals that ReopenOnSignal() listens for when it is not given any;
+// SIGHUP is what logrotate et al send
+var defaultReopenSignals = []os.Signal{syscall.SIGHUP}
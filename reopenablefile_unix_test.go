@@ -0,0 +1,93 @@
+//go:build unix
+// +build unix
+
+package modlog
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestReopenOnSignal(t *testing.T) {
+	// keep track of who is listening for the signal
+	var notified, stopped []chan<- os.Signal
+	signalNotify = func(c chan<- os.Signal, sig ...os.Signal) {
+		notified = append(notified, c)
+		signal.Notify(c, sig...)
+	}
+	signalStop = func(c chan<- os.Signal) {
+		stopped = append(stopped, c)
+		signal.Stop(c)
+	}
+	defer func() {
+		signalNotify = signal.Notify
+		signalStop = signal.Stop
+	}()
+
+	// make sure the signal never stops the test, even once the logger
+	// is no longer listening for it
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGUSR1)
+	defer signal.Stop(guard)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	l := NewLogger()
+	_, err := l.AddReopenableFileOutput("default", path, ReopenOptions{})
+	assert.Equal(t, nil, err)
+	stop := l.ReopenOnSignal(syscall.SIGUSR1)
+
+	l.Info("one")
+	assert.Equal(t, nil, os.Rename(path, path+".1"))
+	assert.Equal(t, nil, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	<-guard
+
+	// the reopen happens in the background
+	for i := 0; i < 100 && !fileExists(path); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	l.Info("two")
+
+	stop()
+	stop()
+	assert.Equal(t, 1, len(notified))
+	assert.Equal(t, notified, stopped)
+
+	// once stopped, the signal no longer reopens the file
+	assert.Equal(t, nil, os.Rename(path, path+".2"))
+	assert.Equal(t, nil, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	<-guard
+	time.Sleep(50 * time.Millisecond)
+	l.Info("three")
+	assert.Equal(t, nil, l.Close())
+
+	assert.Equal(t, false, fileExists(path))
+	moved, _ := os.ReadFile(path + ".1")
+	assert.Equal(t, "one\n", string(moved))
+	moved, _ = os.ReadFile(path + ".2")
+	assert.Equal(t, "two\nthree\n", string(moved))
+}
+
+func TestReopenOnSignalDefaultsToSIGHUP(t *testing.T) {
+	var signals []os.Signal
+	signalNotify = func(c chan<- os.Signal, sig ...os.Signal) {
+		signals = sig
+	}
+	signalStop = func(c chan<- os.Signal) {}
+	defer func() {
+		signalNotify = signal.Notify
+		signalStop = signal.Stop
+	}()
+
+	stop := NewLogger().ReopenOnSignal()
+	stop()
+
+	assert.Equal(t, []os.Signal{syscall.SIGHUP}, signals)
+}
@@ -0,0 +1,476 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RotateOptions decides when a RotatingFile is rotated, and what happens
+// to the old files afterwards
+type RotateOptions struct {
+	// rotate once the file would grow beyond this many bytes
+	//
+	// set this to 0 to never rotate because of size
+	MaxSize int64
+
+	// rotate at every multiple of this interval, e.g. time.Hour rotates
+	// at the top of every hour
+	//
+	// intervals are lined up with midnight in the local time zone, so
+	// 24 * time.Hour rotates at local midnight
+	//
+	// set this to 0 to never rotate because of time
+	Interval time.Duration
+
+	// how many rotated files to keep
+	//
+	// set this to 0 to keep them all
+	MaxBackups int
+
+	// how long to keep rotated files for
+	//
+	// set this to 0 to keep them forever
+	MaxAge time.Duration
+
+	// set this to gzip rotated files in the background
+	Compress bool
+
+	// the permissions to create the log file with; defaults to 0644
+	FileMode os.FileMode
+}
+
+// the layout that we add to the end of rotated files
+const rotatedFileTimeFormat = "20060102-150405"
+
+// matches the suffix that rotate() adds to the end of rotated files, and
+// captures the time and the (optional) number that make it unique
+var rotatedFileSuffix = regexp.MustCompile(`^\.([0-9]{8}-[0-9]{6})(?:\.([0-9]+))?(\.gz)?$`)
+
+// RotatingFile is an io.Writer that writes to a file on disk, and rotates
+// that file by size and/or by time
+//
+// rotated files are named after the original file, with the time of the
+// rotation added to the end (e.g. app.log.20140102-150405)
+type RotatingFile struct {
+	path    string
+	options RotateOptions
+
+	// the file that we are currently writing to, and where it is
+	//
+	// current is only different to path if we could not open a new file
+	// after the last rotation, and went back to writing to the old one
+	//
+	// file is nil if we could not reopen either of them; we try again
+	// on the next write
+	file    *os.File
+	current string
+	size    int64
+
+	// set once Close() has been called
+	closed bool
+
+	// when we next need to rotate because of time
+	nextRotation time.Time
+
+	// used to compress and clean up old files in the background
+	wg        sync.WaitGroup
+	cleanupMu sync.Mutex
+
+	// allows the tests to control time
+	now func() time.Time
+
+	// allows the tests to make opening a file fail
+	openFile func(name string, flag int, perm os.FileMode) (*os.File, error)
+
+	mu sync.Mutex
+}
+
+// OpenRotatingFile() opens the file at path for appending, creating it if
+// it does not exist
+func OpenRotatingFile(path string, options RotateOptions) (*RotatingFile, error) {
+	if options.FileMode == 0 {
+		options.FileMode = 0644
+	}
+
+	retval := &RotatingFile{
+		path:     path,
+		options:  options,
+		now:      time.Now,
+		openFile: os.OpenFile,
+	}
+
+	err := retval.open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return retval, nil
+}
+
+// AddRotatingFileOutput() creates a new output that writes to a
+// RotatingFile at the given path
+func (self *Logger) AddRotatingFileOutput(name string, path string, options RotateOptions) (*LogOutput, error) {
+	file, err := OpenRotatingFile(path, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.AddOutput(name, file), nil
+}
+
+// Path() returns the path of the file that we write to
+func (self *RotatingFile) Path() string {
+	return self.path
+}
+
+// Write() writes to the current file, rotating it first if required
+func (self *RotatingFile) Write(p []byte) (int, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.closed {
+		return 0, os.ErrClosed
+	}
+
+	// did we lose our file during the last rotation?
+	if self.file == nil {
+		err := self.open(self.path)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if self.needsRotating(int64(len(p))) {
+		// if we cannot rotate, we keep writing to the old file rather
+		// than lose the entry
+		err := self.rotate()
+		if self.file == nil {
+			return 0, err
+		}
+	}
+
+	n, err := self.file.Write(p)
+	self.size += int64(n)
+
+	return n, err
+}
+
+// Rotate() rotates the file now, regardless of its size or age
+func (self *RotatingFile) Rotate() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.closed {
+		return os.ErrClosed
+	}
+
+	// there is nothing to move out of the way
+	if self.file == nil {
+		return self.open(self.path)
+	}
+
+	return self.rotate()
+}
+
+// Sync() commits the current file to stable storage
+func (self *RotatingFile) Sync() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.closed {
+		return os.ErrClosed
+	}
+	if self.file == nil {
+		return nil
+	}
+
+	return self.file.Sync()
+}
+
+// Close() closes the current file, and waits for any background
+// compression to finish
+func (self *RotatingFile) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.closed {
+		return os.ErrClosed
+	}
+	self.closed = true
+
+	var err error
+	if self.file != nil {
+		err = self.file.Close()
+		self.file = nil
+	}
+	self.wg.Wait()
+
+	return err
+}
+
+// needsRotating() returns true if the file must be rotated before we can
+// write 'length' more bytes to it
+func (self *RotatingFile) needsRotating(length int64) bool {
+	if self.options.MaxSize > 0 && self.size > 0 && self.size+length > self.options.MaxSize {
+		return true
+	}
+	if self.options.Interval <= 0 {
+		return false
+	}
+
+	now := self.now()
+	if self.nextRotation.IsZero() {
+		self.nextRotation = self.rotationAfter(now)
+		return false
+	}
+	if now.Before(self.nextRotation) {
+		return false
+	}
+
+	// there's no point rotating an empty file
+	if self.size > 0 {
+		return true
+	}
+	self.nextRotation = self.rotationAfter(now)
+
+	return false
+}
+
+// rotationAfter() returns the first rotation time after 'when'
+//
+// rotation times are lined up with midnight in when's time zone, rather
+// than with midnight UTC as time.Truncate() would do
+func (self *RotatingFile) rotationAfter(when time.Time) time.Time {
+	interval := self.options.Interval
+	year, month, day := when.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, when.Location())
+
+	// whole days are counted on the calendar, so that daylight saving
+	// does not move them away from midnight
+	const wholeDay = 24 * time.Hour
+	if interval%wholeDay == 0 {
+		return midnight.AddDate(0, 0, int(interval/wholeDay))
+	}
+
+	sinceMidnight := when.Sub(midnight)
+	return midnight.Add(sinceMidnight - sinceMidnight%interval + interval)
+}
+
+// open() opens the given path for appending, and makes it our current file
+//
+// our current file is left alone if this fails
+func (self *RotatingFile) open(path string) error {
+	file, err := self.openFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, self.options.FileMode)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	self.file = file
+	self.current = path
+	self.size = info.Size()
+
+	// an existing file is due for rotation based on when it was last
+	// written to; a new file waits until we first write to it
+	self.nextRotation = time.Time{}
+	if self.options.Interval > 0 && self.size > 0 {
+		self.nextRotation = self.rotationAfter(info.ModTime())
+	}
+
+	return nil
+}
+
+// rotate() moves the current file out of the way, and opens a new one
+//
+// if we cannot open the new file, we go back to writing to the old one,
+// wherever it is now, so that we do not lose any entries
+//
+// the caller must hold our lock
+func (self *RotatingFile) rotate() error {
+	closeErr := self.file.Close()
+
+	// an earlier rotation may already have moved the file out of the way
+	backupPath := self.current
+	var renameErr error
+	if self.current == self.path {
+		backupPath = self.backupPath()
+		renameErr = os.Rename(self.path, backupPath)
+		if renameErr != nil {
+			backupPath = self.path
+		}
+	}
+
+	// we always reopen, even if the rename failed, so that we can keep
+	// on writing
+	err := self.open(self.path)
+	if err != nil {
+		if backupPath == self.path || self.open(backupPath) != nil {
+			// Write() tries again next time
+			self.file = nil
+			self.current = ""
+		}
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	// compress and tidy up in the background, so that we are not holding
+	// up anyone who is logging
+	self.wg.Add(1)
+	go self.afterRotate(backupPath, self.now())
+
+	return nil
+}
+
+// backupPath() returns a path that does not exist yet, for the rotated
+// file to be moved to
+func (self *RotatingFile) backupPath() string {
+	base := self.path + "." + self.now().Format(rotatedFileTimeFormat)
+	retval := base
+	for i := 1; ; i++ {
+		if !fileExists(retval) && !fileExists(retval+".gz") {
+			return retval
+		}
+		retval = fmt.Sprintf("%s.%d", base, i)
+	}
+}
+
+// afterRotate() compresses the rotated file if required, and then removes
+// any rotated files that we no longer want
+func (self *RotatingFile) afterRotate(backupPath string, rotatedAt time.Time) {
+	defer self.wg.Done()
+
+	self.cleanupMu.Lock()
+	defer self.cleanupMu.Unlock()
+
+	if self.options.Compress {
+		compressFile(backupPath)
+	}
+	self.removeOldFiles(rotatedAt)
+}
+
+// removeOldFiles() enforces MaxBackups and MaxAge
+func (self *RotatingFile) removeOldFiles(now time.Time) {
+	if self.options.MaxBackups <= 0 && self.options.MaxAge <= 0 {
+		return
+	}
+
+	backups := self.rotatedFiles()
+
+	cutoff := now.Add(-self.options.MaxAge)
+	for i := range backups {
+		// newest first
+		backup := backups[len(backups)-1-i]
+		if self.options.MaxBackups > 0 && i >= self.options.MaxBackups {
+			os.Remove(backup)
+			continue
+		}
+		if self.options.MaxAge > 0 {
+			info, err := os.Stat(backup)
+			if err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(backup)
+			}
+		}
+	}
+}
+
+// rotatedFiles() returns the paths of all of our rotated files, oldest
+// first
+func (self *RotatingFile) rotatedFiles() []string {
+	dir := filepath.Dir(self.path)
+	base := filepath.Base(self.path)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	type rotatedFile struct {
+		path  string
+		when  string
+		index int
+	}
+	files := make([]rotatedFile, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if len(name) <= len(base) || name[:len(base)] != base {
+			continue
+		}
+		matches := rotatedFileSuffix.FindStringSubmatch(name[len(base):])
+		if matches == nil {
+			continue
+		}
+
+		// backupPath() numbers files that were rotated within the same
+		// second; the first one has no number
+		index, _ := strconv.Atoi(matches[2])
+		files = append(files, rotatedFile{path: filepath.Join(dir, name), when: matches[1], index: index})
+	}
+
+	// a plain sort by name would put .10 before .9
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].when != files[j].when {
+			return files[i].when < files[j].when
+		}
+		return files[i].index < files[j].index
+	})
+
+	retval := make([]string, len(files))
+	for i, file := range files {
+		retval[i] = file.path
+	}
+
+	return retval
+}
+
+// compressFile() replaces the file at path with a gzipped copy
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
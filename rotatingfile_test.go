@@ -0,0 +1,164 @@
+package modlog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	now := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	file, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10, MaxBackups: 2})
+	assert.Equal(t, nil, err)
+	file.now = func() time.Time { return now }
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		_, err = file.Write([]byte(line))
+		assert.Equal(t, nil, err)
+		now = now.Add(time.Second)
+	}
+	assert.Equal(t, nil, file.Close())
+
+	current, _ := os.ReadFile(path)
+	assert.Equal(t, "dddddddd\n", string(current))
+
+	// the oldest file has been removed
+	backups := file.rotatedFiles()
+	assert.Equal(t, []string{path + ".20140102-030407", path + ".20140102-030408"}, backups)
+}
+
+func TestRotatingFileRotatesByTimeAndCompresses(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	now := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	l := NewLogger()
+	output, err := l.AddRotatingFileOutput("default", path, RotateOptions{Interval: time.Hour, Compress: true})
+	assert.Equal(t, nil, err)
+	output.Out.(*RotatingFile).now = func() time.Time { return now }
+
+	l.Info("first hour")
+	now = now.Add(time.Hour)
+	l.Info("second hour")
+	assert.Equal(t, nil, l.Close())
+
+	current, _ := os.ReadFile(path)
+	assert.Equal(t, "second hour\n", string(current))
+	_, err = os.Stat(path + ".20140102-040405.gz")
+	assert.Equal(t, nil, err)
+}
+
+func TestRotatingFileKeepsWritingWhenItCannotOpenANewFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	now := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	file, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10})
+	assert.Equal(t, nil, err)
+	file.now = func() time.Time { return now }
+
+	_, err = file.Write([]byte("aaaaaaaa\n"))
+	assert.Equal(t, nil, err)
+
+	// we cannot open a new file at our path
+	openErr := errors.New("too many open files")
+	file.openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		if name == path {
+			return nil, openErr
+		}
+		return os.OpenFile(name, flag, perm)
+	}
+	_, err = file.Write([]byte("bbbbbbbb\n"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, openErr, file.Rotate())
+	_, err = file.Write([]byte("cccccccc\n"))
+	assert.Equal(t, nil, err)
+
+	// everything went to the old file, which has been moved out of the way
+	backup := path + ".20140102-030405"
+	contents, _ := os.ReadFile(backup)
+	assert.Equal(t, "aaaaaaaa\nbbbbbbbb\ncccccccc\n", string(contents))
+
+	// once we can open a new file, we go back to writing at our path
+	file.openFile = os.OpenFile
+	_, err = file.Write([]byte("dddddddd\n"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, file.Close())
+
+	current, _ := os.ReadFile(path)
+	assert.Equal(t, "dddddddd\n", string(current))
+	contents, _ = os.ReadFile(backup)
+	assert.Equal(t, "aaaaaaaa\nbbbbbbbb\ncccccccc\n", string(contents))
+	assert.Equal(t, []string{backup}, file.rotatedFiles())
+}
+
+func TestRotatingFileReopensOnTheNextWriteIfItLosesItsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	now := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	file, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10})
+	assert.Equal(t, nil, err)
+	file.now = func() time.Time { return now }
+
+	_, err = file.Write([]byte("aaaaaaaa\n"))
+	assert.Equal(t, nil, err)
+
+	// we can open neither a new file, nor the old one
+	openErr := errors.New("too many open files")
+	file.openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		return nil, openErr
+	}
+	_, err = file.Write([]byte("bbbbbbbb\n"))
+	assert.Equal(t, openErr, err)
+	_, err = file.Write([]byte("bbbbbbbb\n"))
+	assert.Equal(t, openErr, err)
+	assert.Equal(t, nil, file.Sync())
+
+	file.openFile = os.OpenFile
+	_, err = file.Write([]byte("cccccccc\n"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, file.Close())
+	_, err = file.Write([]byte("dddddddd\n"))
+	assert.Equal(t, os.ErrClosed, err)
+
+	current, _ := os.ReadFile(path)
+	assert.Equal(t, "cccccccc\n", string(current))
+	contents, _ := os.ReadFile(path + ".20140102-030405")
+	assert.Equal(t, "aaaaaaaa\n", string(contents))
+}
+
+func TestRotatingFileRemovesTheOldestBackupsFirst(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	file, err := OpenRotatingFile(path, RotateOptions{MaxBackups: 3})
+	assert.Equal(t, nil, err)
+	defer file.Close()
+
+	base := path + ".20140102-030405"
+	for _, name := range []string{path + ".20140101-235959.12", base, base + ".1", base + ".2.gz", base + ".9", base + ".10.gz"} {
+		assert.Equal(t, nil, os.WriteFile(name, nil, 0644))
+	}
+	file.removeOldFiles(time.Now())
+
+	assert.Equal(t, []string{base + ".2.gz", base + ".9", base + ".10.gz"}, file.rotatedFiles())
+}
+
+func TestRotatingFileRotatesOnLocalTimeBoundaries(t *testing.T) {
+	tz := time.FixedZone("UTC+5:30", 5*60*60+30*60)
+	when := time.Date(2014, 1, 2, 10, 15, 0, 0, tz)
+
+	hourly := &RotatingFile{options: RotateOptions{Interval: time.Hour}}
+	assert.Equal(t, time.Date(2014, 1, 2, 11, 0, 0, 0, tz), hourly.rotationAfter(when))
+
+	daily := &RotatingFile{options: RotateOptions{Interval: 24 * time.Hour}}
+	assert.Equal(t, time.Date(2014, 1, 3, 0, 0, 0, 0, tz), daily.rotationAfter(when))
+}
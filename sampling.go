@@ -0,0 +1,262 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stuartherbert/go_options"
+)
+
+// the most keys that each SamplingRule tracks at once
+const maxSampleKeys = 10000
+
+// SamplingRule decides which entries a Sampler keeps
+//
+// a rule either keeps the first First entries per Interval and then every
+// Thereafter-th entry, or (if First and Thereafter are both 0) it keeps a
+// Rate fraction of the entries; a rule that sets none of them is an error
+type SamplingRule struct {
+	// the module that the rule applies to, including its submodules;
+	// use "" or AllModules for every module
+	Module string
+
+	// the rule applies to entries at this level and anything more
+	// verbose, e.g. DebugLevel covers debug and trace entries
+	//
+	// defaults to DebugLevel, so that a rule never samples away warnings
+	// and errors by accident; set a more important level if you really
+	// do want to sample those
+	Level LogLevel
+
+	// how many entries per key to keep in each interval
+	First int
+
+	// once First entries have been kept, keep every Thereafter-th entry
+	// after that; set this to 0 to keep no more until the next interval
+	Thereafter int
+
+	// defaults to time.Second
+	Interval time.Duration
+
+	// which entries are counted together; defaults to KeyByCallSite
+	Key EntryKeyFunc
+
+	// the fraction of entries to keep, from 0 to 1
+	Rate float64
+
+	// if set, Rate is applied to the hash of this key rather than at
+	// random, so that entries with the same key (such as a request ID)
+	// are kept or dropped together
+	HashKey EntryKeyFunc
+}
+
+// Sampler is a filter that keeps a sample of high-volume entries
+type Sampler struct {
+	rules []SamplingRule
+
+	// one set of counters per rule
+	counters []map[string]*sampleCounter
+
+	// allow the tests to control time and chance
+	now    func() time.Time
+	random func() float64
+
+	mu sync.Mutex
+}
+
+// sampleCounter counts the entries for a single key in the current
+// interval
+type sampleCounter struct {
+	start time.Time
+	count int
+}
+
+// NewSampler() creates a new Sampler
+//
+// each entry is checked against the rules in order, and the first rule
+// that applies decides whether it is kept; entries that no rule applies
+// to are always kept
+//
+// it returns an error if any of the rules would throw away everything
+func NewSampler(rules ...SamplingRule) (*Sampler, error) {
+	retval := &Sampler{
+		rules:    make([]SamplingRule, len(rules)),
+		counters: make([]map[string]*sampleCounter, len(rules)),
+		now:      time.Now,
+		random:   rand.Float64,
+	}
+
+	for i, rule := range rules {
+		err := rule.validate()
+		if err != nil {
+			return nil, fmt.Errorf("sampling rule %d: %s", i, err.Error())
+		}
+
+		rule.Module = normaliseModuleName(rule.Module)
+		if rule.Level == EmergencyLevel {
+			rule.Level = DebugLevel
+		}
+		if rule.Interval <= 0 {
+			rule.Interval = time.Second
+		}
+		if rule.Key == nil {
+			rule.Key = KeyByCallSite
+		}
+		retval.rules[i] = rule
+		retval.counters[i] = make(map[string]*sampleCounter)
+	}
+
+	return retval, nil
+}
+
+// AddSamplingFilter() creates a new Sampler, and adds it to our filters
+// under the given name
+func (self *Logger) AddSamplingFilter(name string, rules ...SamplingRule) (*Sampler, error) {
+	retval, err := NewSampler(rules...)
+	if err != nil {
+		return nil, err
+	}
+	self.AddFilter(name, retval.Filter)
+
+	return retval, nil
+}
+
+// Filter() is a LogFilter that returns false for any entry that is not
+// part of the sample
+func (self *Sampler) Filter(os *options.OptionsStore, entry *LogEntry) bool {
+	for i := range self.rules {
+		rule := &self.rules[i]
+		if !rule.appliesTo(entry) {
+			continue
+		}
+
+		if rule.First > 0 || rule.Thereafter > 0 {
+			return self.keepByCount(i, entry)
+		}
+		return self.keepByRate(rule, entry)
+	}
+
+	return true
+}
+
+// keepByCount() keeps the first First entries per interval, and then every
+// Thereafter-th entry
+func (self *Sampler) keepByCount(ruleIndex int, entry *LogEntry) bool {
+	rule := &self.rules[ruleIndex]
+	key := rule.Key(entry)
+	if len(key) == 0 {
+		return true
+	}
+	now := self.now()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	counters := self.counters[ruleIndex]
+	counter, ok := counters[key]
+	if !ok {
+		if len(counters) >= maxSampleKeys {
+			pruneSampleCounters(counters, now, rule.Interval)
+		}
+		counter = &sampleCounter{start: now}
+		counters[key] = counter
+	}
+
+	// start a new interval?
+	if now.Sub(counter.start) >= rule.Interval {
+		counter.start = now
+		counter.count = 0
+	}
+	counter.count++
+
+	if counter.count <= rule.First {
+		return true
+	}
+
+	return rule.Thereafter > 0 && (counter.count-rule.First)%rule.Thereafter == 0
+}
+
+// keepByRate() keeps a Rate fraction of the entries
+func (self *Sampler) keepByRate(rule *SamplingRule, entry *LogEntry) bool {
+	if rule.HashKey != nil {
+		key := rule.HashKey(entry)
+		if len(key) > 0 {
+			return hashFraction(key) < rule.Rate
+		}
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.random() < rule.Rate
+}
+
+// validate() returns an error if the rule makes no sense
+func (self *SamplingRule) validate() error {
+	if self.First < 0 || self.Thereafter < 0 {
+		return errors.New("First and Thereafter cannot be negative")
+	}
+	if self.Rate < 0 || self.Rate > 1 {
+		return fmt.Errorf("Rate must be between 0 and 1, not %g", self.Rate)
+	}
+	if self.First == 0 && self.Thereafter == 0 && self.Rate == 0 {
+		return errors.New("the rule keeps nothing; set First, Thereafter or Rate")
+	}
+
+	return nil
+}
+
+// appliesTo() returns true if the rule covers the given entry
+func (self *SamplingRule) appliesTo(entry *LogEntry) bool {
+	if entry.LogLevel < self.Level {
+		return false
+	}
+	if len(self.Module) == 0 || self.Module == AllModules {
+		return true
+	}
+
+	module := normaliseModuleName(entry.Module)
+	return module == self.Module || strings.HasPrefix(module, self.Module+".")
+}
+
+// pruneSampleCounters() forgets counters whose interval is over; if that
+// does not make enough room, it forgets them all
+func pruneSampleCounters(counters map[string]*sampleCounter, now time.Time, interval time.Duration) {
+	for key, counter := range counters {
+		if now.Sub(counter.start) >= interval {
+			delete(counters, key)
+		}
+	}
+
+	if len(counters) >= maxSampleKeys {
+		for key := range counters {
+			delete(counters, key)
+		}
+	}
+}
+
+// hashFraction() turns the key into a number from 0 up to (but not
+// including) 1, which is always the same for the same key
+func hashFraction(key string) float64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+
+	// FNV's high bits are poorly spread for short keys, so we mix them
+	// (this is the finaliser from MurmurHash3)
+	sum := hash.Sum64()
+	sum ^= sum >> 33
+	sum *= 0xff51afd7ed558ccd
+	sum ^= sum >> 33
+	sum *= 0xc4ceb9fe1a85ec53
+	sum ^= sum >> 33
+
+	// a float64 only has 53 bits of precision
+	return float64(sum>>11) / (1 << 53)
+}
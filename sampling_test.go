@@ -0,0 +1,83 @@
+package modlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestSamplerKeepsFirstThenEveryMth(t *testing.T) {
+	sampler, err := NewSampler(SamplingRule{
+		Level:      DebugLevel,
+		First:      2,
+		Thereafter: 3,
+		Key:        KeyByMessage,
+	})
+	assert.Equal(t, nil, err)
+	now := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	sampler.now = func() time.Time { return now }
+
+	var kept []bool
+	for i := 0; i < 8; i++ {
+		kept = append(kept, sampler.Filter(nil, NewLogEntry(TraceLevel, "", "tick")))
+	}
+	assert.Equal(t, []bool{true, true, false, false, true, false, false, true}, kept)
+
+	// more important entries are not sampled
+	assert.Equal(t, true, sampler.Filter(nil, NewLogEntry(InfoLevel, "", "tick")))
+
+	// the count starts again in the next interval
+	now = now.Add(time.Second)
+	assert.Equal(t, true, sampler.Filter(nil, NewLogEntry(TraceLevel, "", "tick")))
+}
+
+func TestSamplerKeepsWholeRequestsTogether(t *testing.T) {
+	sampler, err := NewSampler(SamplingRule{
+		Module:  "http",
+		Level:   TraceLevel,
+		Rate:    0.5,
+		HashKey: KeyByField("requestId"),
+	})
+	assert.Equal(t, nil, err)
+
+	kept := 0
+	for i := 0; i < 100; i++ {
+		requestId := string(rune('a'+i%26)) + string(rune('a'+i/26))
+		first := NewLogEntry(TraceLevel, "http.server", "start")
+		first.Data["requestId"] = requestId
+		second := NewLogEntry(TraceLevel, "http.server", "end")
+		second.Data["requestId"] = requestId
+
+		keepFirst := sampler.Filter(nil, first)
+		assert.Equal(t, keepFirst, sampler.Filter(nil, second))
+		if keepFirst {
+			kept++
+		}
+	}
+	assert.T(t, kept > 20 && kept < 80)
+
+	// other modules are not sampled
+	assert.Equal(t, true, sampler.Filter(nil, NewLogEntry(TraceLevel, "db", "query")))
+}
+
+func TestSamplerRulesWithoutALevelOnlySampleDebugAndTrace(t *testing.T) {
+	sampler, err := NewSampler(SamplingRule{Rate: 0.1})
+	assert.Equal(t, nil, err)
+	sampler.random = func() float64 { return 0.5 }
+
+	assert.Equal(t, true, sampler.Filter(nil, NewLogEntry(ErrorLevel, "", "failed")))
+	assert.Equal(t, true, sampler.Filter(nil, NewLogEntry(InfoLevel, "", "started")))
+	assert.Equal(t, false, sampler.Filter(nil, NewLogEntry(DebugLevel, "", "tick")))
+	assert.Equal(t, false, sampler.Filter(nil, NewLogEntry(TraceLevel, "", "tick")))
+}
+
+func TestSamplerRejectsRulesThatKeepNothing(t *testing.T) {
+	_, err := NewSampler(SamplingRule{Rate: 0.5}, SamplingRule{Module: "db"})
+	assert.Equal(t, "sampling rule 1: the rule keeps nothing; set First, Thereafter or Rate", err.Error())
+
+	logger := NewLogger()
+	_, err = logger.AddSamplingFilter("sample", SamplingRule{Rate: 2})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, 0, len(logger.FilterNames()))
+}
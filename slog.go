@@ -0,0 +1,266 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+
+//go:build go1.21
+// +build go1.21
+
+package modlog
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"runtime"
+)
+
+// SlogHandlerOptions controls how a SlogHandler converts slog records into
+// log entries
+type SlogHandlerOptions struct {
+	// the module to log entries as
+	Module string
+
+	// if set, a top-level string attribute with this key is used as the
+	// entry's module instead of being added to LogEntry.Data
+	//
+	// this works for attributes added by WithAttrs() too
+	ModuleKey string
+
+	// if set, records below this level are discarded before they are
+	// converted; otherwise, the Logger's own log levels decide
+	Level slog.Leveler
+}
+
+// SlogHandler is an slog.Handler that sends everything through a modlog
+// Logger, so that log/slog code can use our outputs, filters and
+// formatters
+type SlogHandler struct {
+	logger  *Logger
+	options SlogHandlerOptions
+
+	// attributes added by WithAttrs(), already flattened
+	fields LogFields
+
+	// the group names added by WithGroup(), as a prefix for keys
+	prefix string
+}
+
+// NewSlogHandler() creates a new slog.Handler that writes to the given
+// logger
+//
+// use it with slog.New() to create an *slog.Logger
+func NewSlogHandler(logger *Logger, options SlogHandlerOptions) *SlogHandler {
+	return &SlogHandler{
+		logger:  logger,
+		options: options,
+		fields:  LogFields{},
+	}
+}
+
+// Enabled() reports whether we want records at the given level
+func (self *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if self.options.Level != nil {
+		return level >= self.options.Level.Level()
+	}
+
+	entry := LogEntry{
+		LogLevel: SlogLevelToLogLevel(level),
+		Module:   self.options.Module,
+	}
+	return FilterLogToModuleLevel(self.logger.Options, &entry)
+}
+
+// Handle() converts the record into a LogEntry, and sends it through our
+// logger
+func (self *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	entry := NewLogEntry(SlogLevelToLogLevel(record.Level), self.options.Module, record.Message)
+	if !record.Time.IsZero() {
+		entry.When = record.Time
+	}
+	if record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		entry.Caller = newLogCaller(&frame)
+	}
+
+	for key, value := range self.logger.contextFields(ctx) {
+		entry.Data[key] = value
+	}
+	for key, value := range self.fields {
+		entry.Data[key] = value
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		if module, ok := self.moduleFromAttr(attr); ok {
+			entry.Module = module
+			return true
+		}
+		addSlogAttr(entry.Data, self.prefix, attr)
+		return true
+	})
+
+	return self.logger.processEntry(entry)
+}
+
+// WithAttrs() returns a new handler that adds the given attributes to
+// every record
+func (self *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	retval := self.clone()
+	for _, attr := range attrs {
+		if module, ok := self.moduleFromAttr(attr); ok {
+			retval.options.Module = module
+			continue
+		}
+		addSlogAttr(retval.fields, self.prefix, attr)
+	}
+
+	return retval
+}
+
+// moduleFromAttr() returns the module that the attribute names, if it is
+// our ModuleKey attribute
+func (self *SlogHandler) moduleFromAttr(attr slog.Attr) (string, bool) {
+	if len(self.prefix) > 0 || len(self.options.ModuleKey) == 0 || attr.Key != self.options.ModuleKey {
+		return "", false
+	}
+	module, ok := attr.Value.Resolve().Any().(string)
+
+	return module, ok
+}
+
+// WithGroup() returns a new handler that puts all further attributes
+// inside the named group
+//
+// groups are flattened into LogEntry.Data keys, e.g. 'request.method'
+func (self *SlogHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return self
+	}
+
+	retval := self.clone()
+	retval.prefix = self.prefix + name + "."
+
+	return retval
+}
+
+func (self *SlogHandler) clone() *SlogHandler {
+	retval := &SlogHandler{
+		logger:  self.logger,
+		options: self.options,
+		fields:  make(LogFields, len(self.fields)),
+		prefix:  self.prefix,
+	}
+	for key, value := range self.fields {
+		retval.fields[key] = value
+	}
+
+	return retval
+}
+
+// addSlogAttr() adds the attribute to data, flattening any groups
+func addSlogAttr(data LogFields, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() != slog.KindGroup {
+		data[prefix+attr.Key] = attr.Value.Any()
+		return
+	}
+
+	// a group with no key is inlined
+	if len(attr.Key) > 0 {
+		prefix = prefix + attr.Key + "."
+	}
+	for _, member := range attr.Value.Group() {
+		addSlogAttr(data, prefix, member)
+	}
+}
+
+// SlogLevelToLogLevel() converts an slog level into the nearest modlog
+// level
+//
+// levels above slog.LevelError map onto CriticalLevel, AlertLevel and
+// EmergencyLevel in steps of 4
+func SlogLevelToLogLevel(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelDebug:
+		return TraceLevel
+	case level < slog.LevelInfo:
+		return DebugLevel
+	case level < slog.LevelInfo+2:
+		return InfoLevel
+	case level < slog.LevelWarn:
+		return NoticeLevel
+	case level < slog.LevelError:
+		return WarnLevel
+	case level < slog.LevelError+4:
+		return ErrorLevel
+	case level < slog.LevelError+8:
+		return CriticalLevel
+	case level < slog.LevelError+12:
+		return AlertLevel
+	default:
+		return EmergencyLevel
+	}
+}
+
+// LogLevelToSlogLevel() converts a modlog level into an slog level
+//
+// it is the reverse of SlogLevelToLogLevel()
+func LogLevelToSlogLevel(level LogLevel) slog.Level {
+	switch level {
+	case EmergencyLevel:
+		return slog.LevelError + 12
+	case AlertLevel:
+		return slog.LevelError + 8
+	case CriticalLevel:
+		return slog.LevelError + 4
+	case ErrorLevel:
+		return slog.LevelError
+	case WarnLevel:
+		return slog.LevelWarn
+	case NoticeLevel:
+		return slog.LevelInfo + 2
+	case InfoLevel:
+		return slog.LevelInfo
+	case DebugLevel:
+		return slog.LevelDebug
+	default:
+		return slog.LevelDebug - 4
+	}
+}
+
+// AddSlogOutput() creates a new output that forwards log entries to an
+// existing slog.Handler
+func (self *Logger) AddSlogOutput(name string, handler slog.Handler) *LogOutput {
+	return self.AddOutput(name, io.Discard).SetCheckedWriter(NewSlogOutputWriter(handler))
+}
+
+// NewSlogOutputWriter() returns a CheckedOutputWriter that converts each
+// log entry into an slog.Record, and passes it to the given handler
+//
+// the output's io.Writer is not used; the entry's module is passed as
+// the 'module' attribute
+func NewSlogOutputWriter(handler slog.Handler) CheckedOutputWriter {
+	return func(out io.Writer, entry *LogEntry, data map[string]string) error {
+		ctx := context.Background()
+		level := LogLevelToSlogLevel(entry.LogLevel)
+		if !handler.Enabled(ctx, level) {
+			return nil
+		}
+
+		// the PC lets the handler report the entry's source
+		var pc uintptr
+		if entry.Caller != nil {
+			pc = entry.Caller.PC
+		}
+		record := slog.NewRecord(entry.When, level, entry.Message, pc)
+		if len(entry.Module) > 0 {
+			record.AddAttrs(slog.String("module", entry.Module))
+		}
+		for _, key := range sortedFieldKeys(entry.Data) {
+			record.AddAttrs(slog.Any(key, entry.Data[key]))
+		}
+
+		return handler.Handle(ctx, record)
+	}
+}
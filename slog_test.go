@@ -0,0 +1,114 @@
+//go:build go1.21
+// +build go1.21
+
+package modlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestSlogHandlerConvertsRecords(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+	slogger := slog.New(NewSlogHandler(logger, SlogHandlerOptions{Module: "app", ModuleKey: "module"}))
+
+	slogger.With("service", "billing").
+		WithGroup("request").
+		With("method", "GET").
+		Warn("slow", "ms", 120, slog.Group("user", "id", 7))
+	slogger.Error("failed", "module", "db")
+
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, WarnLevel, entries[0].LogLevel)
+	assert.Equal(t, "app", entries[0].Module)
+	assert.Equal(t, "slow", entries[0].Message)
+	assert.Equal(t, LogFields{
+		"service":         "billing",
+		"request.method":  "GET",
+		"request.ms":      int64(120),
+		"request.user.id": int64(7),
+	}, entries[0].Data)
+	assert.T(t, strings.HasSuffix(entries[0].Caller.File, "slog_test.go"))
+
+	assert.Equal(t, ErrorLevel, entries[1].LogLevel)
+	assert.Equal(t, "db", entries[1].Module)
+}
+
+func TestSlogHandlerTakesTheModuleFromWithAttrs(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+	slogger := slog.New(NewSlogHandler(logger, SlogHandlerOptions{Module: "app", ModuleKey: "module"}))
+
+	db := slogger.With("module", "db", "pool", 1)
+	db.Info("connected")
+	db.Info("moved", "module", "cache")
+
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "db", entries[0].Module)
+	assert.Equal(t, LogFields{"pool": int64(1)}, entries[0].Data)
+	assert.Equal(t, "cache", entries[1].Module)
+
+	// without a ModuleKey, it is just another field
+	entries = nil
+	slog.New(NewSlogHandler(logger, SlogHandlerOptions{Module: "app"})).With("module", "db").Info("connected")
+	assert.Equal(t, "app", entries[0].Module)
+	assert.Equal(t, LogFields{"module": "db"}, entries[0].Data)
+}
+
+func TestSlogHandlerHonoursLogLevels(t *testing.T) {
+	var entries []*LogEntry
+	logger := newCapturingLogger(&entries)
+	logger.SetOptions(SetMinLogLevel(InfoLevel))
+	handler := NewSlogHandler(logger, SlogHandlerOptions{})
+
+	assert.Equal(t, false, handler.Enabled(nil, slog.LevelDebug))
+	assert.Equal(t, true, handler.Enabled(nil, slog.LevelInfo))
+}
+
+func TestSlogLevelsRoundTrip(t *testing.T) {
+	for level := EmergencyLevel; level <= TraceLevel; level++ {
+		assert.Equal(t, level, SlogLevelToLogLevel(LogLevelToSlogLevel(level)))
+	}
+}
+
+func TestSlogOutputForwardsToHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger()
+	logger.RemoveOutput("default")
+	logger.AddSlogOutput("slog", slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+
+	logger.Module("db").WithField("table", "users").Warn("slow")
+
+	assert.Equal(t, "level=WARN msg=slow module=db table=users\n", buf.String())
+}
+
+func TestSlogOutputPassesOnTheSource(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger()
+	logger.RemoveOutput("default")
+	logger.AddSlogOutput("slog", slog.NewJSONHandler(&buf, &slog.HandlerOptions{AddSource: true}))
+
+	_, file, line, _ := runtime.Caller(0)
+	logger.Info("hello")
+
+	var record struct {
+		Source slog.Source `json:"source"`
+	}
+	assert.Equal(t, nil, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, file, record.Source.File)
+	assert.Equal(t, line+1, record.Source.Line)
+}
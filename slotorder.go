@@ -0,0 +1,107 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"reflect"
+	"sort"
+)
+
+// filters, formatters and outputs are run in order of their priority,
+// lowest first; slots with the same priority are run in the order that
+// they were added
+const (
+	PriorityFirst   = -100
+	PriorityDefault = 0
+	PriorityLast    = 100
+)
+
+// orderedSlot is a single named slot in a slotOrder
+type orderedSlot struct {
+	name     string
+	priority int
+}
+
+// slotOrder remembers the order that named filters, formatters or
+// outputs must be run in
+//
+// it is not safe for concurrent use; its owner must lock around it
+type slotOrder struct {
+	slots []orderedSlot
+}
+
+// add() puts the named slot at the given priority, moving it if it is
+// already known
+func (self *slotOrder) add(name string, priority int) {
+	self.remove(name)
+
+	// we go after any existing slots with the same priority
+	i := len(self.slots)
+	for i > 0 && self.slots[i-1].priority > priority {
+		i--
+	}
+
+	self.slots = append(self.slots, orderedSlot{})
+	copy(self.slots[i+1:], self.slots[i:])
+	self.slots[i] = orderedSlot{name: name, priority: priority}
+}
+
+// addIfMissing() adds the named slot at PriorityDefault, unless it is
+// already known
+//
+// this allows a slot to be replaced without losing its place
+func (self *slotOrder) addIfMissing(name string) {
+	if self.indexOf(name) >= 0 {
+		return
+	}
+	self.add(name, PriorityDefault)
+}
+
+// remove() forgets the named slot
+func (self *slotOrder) remove(name string) {
+	i := self.indexOf(name)
+	if i < 0 {
+		return
+	}
+	self.slots = append(self.slots[:i], self.slots[i+1:]...)
+}
+
+// names() returns a copy of our slot names, in the order that they are
+// to be run
+func (self *slotOrder) names() []string {
+	retval := make([]string, len(self.slots))
+	for i, slot := range self.slots {
+		retval[i] = slot.name
+	}
+
+	return retval
+}
+
+func (self *slotOrder) indexOf(name string) int {
+	for i, slot := range self.slots {
+		if slot.name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// strays() returns the keys of m (one of the public maps that our owner
+// keeps its filters, formatters or outputs in) that have no slot, sorted
+// by name
+//
+// these have been put straight into the map, rather than added via
+// AddFilter() et al; they are run after all of the ordered slots
+func (self *slotOrder) strays(m interface{}) []string {
+	var retval []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		name := key.String()
+		if self.indexOf(name) < 0 {
+			retval = append(retval, name)
+		}
+	}
+	sort.Strings(retval)
+
+	return retval
+}
@@ -0,0 +1,507 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyslogFacility is the facility part of a syslog message's priority
+type SyslogFacility int
+
+// the facilities defined by RFC 5424
+const (
+	LogKern     = SyslogFacility(0)
+	LogUser     = SyslogFacility(1)
+	LogMail     = SyslogFacility(2)
+	LogDaemon   = SyslogFacility(3)
+	LogAuth     = SyslogFacility(4)
+	LogSyslog   = SyslogFacility(5)
+	LogLpr      = SyslogFacility(6)
+	LogNews     = SyslogFacility(7)
+	LogUucp     = SyslogFacility(8)
+	LogCron     = SyslogFacility(9)
+	LogAuthpriv = SyslogFacility(10)
+	LogFtp      = SyslogFacility(11)
+	LogLocal0   = SyslogFacility(16)
+	LogLocal1   = SyslogFacility(17)
+	LogLocal2   = SyslogFacility(18)
+	LogLocal3   = SyslogFacility(19)
+	LogLocal4   = SyslogFacility(20)
+	LogLocal5   = SyslogFacility(21)
+	LogLocal6   = SyslogFacility(22)
+	LogLocal7   = SyslogFacility(23)
+)
+
+// SyslogFormat is the layout of each syslog message
+type SyslogFormat int
+
+// a list of the supported syslog message layouts
+const (
+	// see https://tools.ietf.org/html/rfc5424
+	SyslogRFC5424 SyslogFormat = iota
+
+	// see https://tools.ietf.org/html/rfc3164
+	SyslogRFC3164
+)
+
+// SyslogModuleField says where LogEntry.Module goes in a syslog message
+type SyslogModuleField int
+
+// a list of the places that LogEntry.Module can go
+const (
+	// use the module as the MSGID, and SyslogConfig.AppName as the
+	// APP-NAME
+	SyslogModuleAsMsgID SyslogModuleField = iota
+
+	// use the module as the APP-NAME (or the TAG, for RFC 3164)
+	SyslogModuleAsAppName
+)
+
+// SyslogFraming says how messages are separated on stream transports
+type SyslogFraming int
+
+// a list of the framing methods from RFC 6587
+//
+// local syslog daemons do not understand octet counting, so messages
+// sent over a "unix" stream socket always end with a newline
+const (
+	// prefix each message with its length; this is the default for
+	// stream transports
+	SyslogOctetCounting SyslogFraming = iota
+
+	// end each message with a newline, for older syslog servers
+	SyslogNonTransparent
+)
+
+// SyslogConfig controls the messages that NewSyslogOutputWriter() writes
+type SyslogConfig struct {
+	// which facility to log to; defaults to LogUser
+	//
+	// user processes cannot log to LogKern, so it is treated as LogUser
+	Facility SyslogFacility
+
+	// which layout to use; defaults to SyslogRFC5424
+	Format SyslogFormat
+
+	// the HOSTNAME field; defaults to os.Hostname()
+	Hostname string
+
+	// the APP-NAME field; defaults to the name of the running program
+	AppName string
+
+	// where to put LogEntry.Module
+	ModuleField SyslogModuleField
+
+	// the SD-ID to put LogEntry.Data under, for RFC 5424
+	//
+	// defaults to modlog@32473 (32473 is the example enterprise number
+	// reserved by RFC 5612)
+	StructuredDataID string
+}
+
+// SyslogDialOptions says where to send syslog messages
+type SyslogDialOptions struct {
+	// one of "unix", "unixgram", "udp", "tcp" or "tcp+tls"
+	//
+	// defaults to "udp" if Address is set; leave both empty to use the
+	// local syslog daemon
+	Network string
+
+	// the address of the syslog server, or the path to its socket
+	//
+	// leave empty to use the local syslog daemon
+	Address string
+
+	// used when Network is "tcp+tls"
+	TLSConfig *tls.Config
+
+	// how messages are separated on stream transports
+	Framing SyslogFraming
+
+	// how long to wait when connecting or writing; 0 means forever
+	Timeout time.Duration
+}
+
+// the sockets that local syslog daemons listen on
+var localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// SyslogConn is an io.Writer that sends each Write() to a syslog server
+// as a single message
+//
+// if the connection is lost, we reconnect on the next write
+type SyslogConn struct {
+	options SyslogDialOptions
+	conn    net.Conn
+
+	// true if we need to frame each message, and how to do it
+	stream  bool
+	framing SyslogFraming
+
+	mu sync.Mutex
+}
+
+// DialSyslog() connects to a syslog server
+func DialSyslog(options SyslogDialOptions) (*SyslogConn, error) {
+	retval := &SyslogConn{
+		options: options,
+	}
+
+	err := retval.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	return retval, nil
+}
+
+// AddSyslogOutput() creates a new output that sends log entries to a
+// syslog server
+func (self *Logger) AddSyslogOutput(name string, dialOptions SyslogDialOptions, config SyslogConfig) (*LogOutput, error) {
+	conn, err := DialSyslog(dialOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.AddOutput(name, conn).SetCheckedWriter(NewSyslogOutputWriter(config)), nil
+}
+
+// Write() sends p to the syslog server as a single message
+func (self *SyslogConn) Write(p []byte) (int, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	// try once, and then reconnect and try again
+	var err error
+	for i := 0; i < 2; i++ {
+		if self.conn == nil {
+			err = self.connect()
+			if err != nil {
+				continue
+			}
+		}
+
+		err = self.send(p)
+		if err == nil {
+			return len(p), nil
+		}
+
+		self.conn.Close()
+		self.conn = nil
+	}
+
+	return 0, err
+}
+
+// Close() closes the connection to the syslog server
+func (self *SyslogConn) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.conn == nil {
+		return nil
+	}
+
+	err := self.conn.Close()
+	self.conn = nil
+	return err
+}
+
+// connect() opens the connection to the syslog server
+//
+// the caller must hold our lock
+func (self *SyslogConn) connect() error {
+	network := self.options.Network
+	address := self.options.Address
+
+	err := self.options.validate()
+	if err != nil {
+		return err
+	}
+
+	// are we talking to the local syslog daemon?
+	if len(network) == 0 && len(address) == 0 {
+		return self.connectLocal()
+	}
+	if len(network) == 0 {
+		network = "udp"
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: self.options.Timeout}
+	if network == "tcp+tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, self.options.TLSConfig)
+	} else {
+		conn, err = dialer.Dial(network, address)
+	}
+	if err != nil {
+		return err
+	}
+
+	self.setConn(conn, network)
+	return nil
+}
+
+// validate() checks that we know how to reach the syslog server, without
+// trying to connect to it
+func (self SyslogDialOptions) validate() error {
+	network := self.Network
+	if len(network) == 0 {
+		if len(self.Address) == 0 {
+			return nil
+		}
+		network = "udp"
+	}
+
+	switch network {
+	case "unix", "unixgram":
+		if len(self.Address) == 0 {
+			return fmt.Errorf("syslog network '%s' needs the path to a socket", network)
+		}
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "tcp+tls":
+		if len(self.Address) == 0 {
+			return fmt.Errorf("syslog network '%s' needs an address", network)
+		}
+		_, _, err := net.SplitHostPort(self.Address)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported syslog network '%s'", network)
+	}
+
+	return nil
+}
+
+// connectLocal() connects to the first local syslog socket that works
+//
+// the caller must hold our lock
+func (self *SyslogConn) connectLocal() error {
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, path := range localSyslogPaths {
+			conn, err := net.DialTimeout(network, path, self.options.Timeout)
+			if err == nil {
+				self.setConn(conn, network)
+				return nil
+			}
+		}
+	}
+
+	return errors.New("unable to connect to the local syslog daemon")
+}
+
+// setConn() makes conn our connection, and works out how to frame the
+// messages that we send over it
+//
+// the caller must hold our lock
+func (self *SyslogConn) setConn(conn net.Conn, network string) {
+	self.conn = conn
+	self.stream = isStreamNetwork(network)
+	self.framing = self.options.Framing
+	if network == "unix" {
+		self.framing = SyslogNonTransparent
+	}
+}
+
+// send() writes a single message, framing it if required
+//
+// the caller must hold our lock
+func (self *SyslogConn) send(p []byte) error {
+	// we never send the trailing newline that our output writers add
+	p = bytes.TrimRight(p, "\n")
+
+	if self.options.Timeout > 0 {
+		self.conn.SetWriteDeadline(time.Now().Add(self.options.Timeout))
+	}
+
+	var msg []byte
+	switch {
+	case !self.stream:
+		msg = p
+	case self.framing == SyslogNonTransparent:
+		msg = append(bytes.ReplaceAll(p, []byte("\n"), []byte(" ")), '\n')
+	default:
+		msg = append([]byte(strconv.Itoa(len(p))+" "), p...)
+	}
+
+	_, err := self.conn.Write(msg)
+	return err
+}
+
+func isStreamNetwork(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return false
+	default:
+		return true
+	}
+}
+
+// NewSyslogOutputWriter() returns a CheckedOutputWriter that formats each
+// log entry as a syslog message
+//
+// use it with a SyslogConn, which takes care of framing each message
+func NewSyslogOutputWriter(config SyslogConfig) CheckedOutputWriter {
+	if config.Facility == LogKern {
+		config.Facility = LogUser
+	}
+	if len(config.Hostname) == 0 {
+		config.Hostname, _ = os.Hostname()
+	}
+	if len(config.AppName) == 0 {
+		config.AppName = filepath.Base(os.Args[0])
+	}
+	if len(config.StructuredDataID) == 0 {
+		config.StructuredDataID = "modlog@32473"
+	}
+	pid := os.Getpid()
+
+	return func(out io.Writer, entry *LogEntry, data map[string]string) error {
+		buf := new(bytes.Buffer)
+		if config.Format == SyslogRFC3164 {
+			formatRFC3164(buf, &config, pid, entry)
+		} else {
+			formatRFC5424(buf, &config, pid, entry)
+		}
+
+		_, err := out.Write(buf.Bytes())
+		return err
+	}
+}
+
+// syslogPriority() combines the facility with the log level
+//
+// syslog has no trace level, so we send those as debug messages
+func syslogPriority(facility SyslogFacility, level LogLevel) int {
+	if level > DebugLevel {
+		level = DebugLevel
+	}
+
+	return int(facility)*8 + int(level)
+}
+
+func formatRFC5424(buf *bytes.Buffer, config *SyslogConfig, pid int, entry *LogEntry) {
+	appName := config.AppName
+	msgID := ""
+	if len(entry.Module) > 0 {
+		if config.ModuleField == SyslogModuleAsAppName {
+			appName = entry.Module
+		} else {
+			msgID = entry.Module
+		}
+	}
+
+	fmt.Fprintf(buf, "<%d>1 ", syslogPriority(config.Facility, entry.LogLevel))
+	buf.WriteString(entry.When.Format("2006-01-02T15:04:05.000000Z07:00"))
+	buf.WriteString(" ")
+	buf.WriteString(syslogHeaderField(config.Hostname, 255))
+	buf.WriteString(" ")
+	buf.WriteString(syslogHeaderField(appName, 48))
+	buf.WriteString(" ")
+	buf.WriteString(strconv.Itoa(pid))
+	buf.WriteString(" ")
+	buf.WriteString(syslogHeaderField(msgID, 32))
+	buf.WriteString(" ")
+	writeSyslogStructuredData(buf, config.StructuredDataID, entry.Data)
+	if len(entry.Message) > 0 {
+		buf.WriteString(" ")
+		buf.WriteString(entry.Message)
+	}
+}
+
+func formatRFC3164(buf *bytes.Buffer, config *SyslogConfig, pid int, entry *LogEntry) {
+	tag := config.AppName
+	message := entry.Message
+	if len(entry.Module) > 0 {
+		if config.ModuleField == SyslogModuleAsAppName {
+			tag = entry.Module
+		} else {
+			message = entry.Module + ": " + message
+		}
+	}
+
+	fmt.Fprintf(buf, "<%d>", syslogPriority(config.Facility, entry.LogLevel))
+	buf.WriteString(entry.When.Format(time.Stamp))
+	buf.WriteString(" ")
+	buf.WriteString(syslogHeaderField(config.Hostname, 255))
+	buf.WriteString(" ")
+	fmt.Fprintf(buf, "%s[%d]: ", syslogHeaderField(tag, 32), pid)
+	buf.WriteString(message)
+}
+
+// syslogHeaderField() makes a value safe to use in the syslog header
+//
+// header fields must be printable US-ASCII with no spaces, and have a
+// maximum length; empty fields are written as '-'
+func syslogHeaderField(value string, maxLen int) string {
+	if len(value) == 0 {
+		return "-"
+	}
+
+	retval := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(retval) > maxLen {
+		retval = retval[:maxLen]
+	}
+
+	return retval
+}
+
+// writeSyslogStructuredData() writes LogEntry.Data as a single RFC 5424
+// SD-ELEMENT, or '-' if there is no data
+func writeSyslogStructuredData(buf *bytes.Buffer, sdID string, fields LogFields) {
+	if len(fields) == 0 {
+		buf.WriteString("-")
+		return
+	}
+
+	buf.WriteString("[")
+	buf.WriteString(sdID)
+	for _, key := range sortedFieldKeys(fields) {
+		buf.WriteString(" ")
+		buf.WriteString(syslogParamName(key))
+		buf.WriteString(`="`)
+		for _, r := range logfmtValueString(fields[key]) {
+			if r == '"' || r == '\\' || r == ']' {
+				buf.WriteRune('\\')
+			}
+			buf.WriteRune(r)
+		}
+		buf.WriteString(`"`)
+	}
+	buf.WriteString("]")
+}
+
+// syslogParamName() makes a key safe to use as an SD-PARAM name
+func syslogParamName(key string) string {
+	if len(key) == 0 {
+		return "_"
+	}
+
+	retval := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+	if len(retval) > 32 {
+		retval = retval[:32]
+	}
+
+	return retval
+}
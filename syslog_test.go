@@ -0,0 +1,121 @@
+package modlog
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func newSyslogTestEntry() *LogEntry {
+	entry := NewLogEntry(WarnLevel, "db", "slow query")
+	entry.When = time.Date(2014, 1, 2, 3, 4, 5, 6000, time.UTC)
+	entry.Data["table"] = `users]"`
+	return entry
+}
+
+func TestSyslogOutputWriterFormatsRFC5424(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewSyslogOutputWriter(SyslogConfig{
+		Facility: LogLocal0,
+		Hostname: "web 1",
+		AppName:  "app",
+	})
+
+	err := writer(&buf, newSyslogTestEntry(), nil)
+
+	assert.Equal(t, nil, err)
+	expected := `<132>1 2014-01-02T03:04:05.000006Z web_1 app ` + strconv.Itoa(os.Getpid()) + ` db [modlog@32473 table="users\]\""] slow query`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestSyslogOutputWriterFormatsRFC3164(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewSyslogOutputWriter(SyslogConfig{
+		Format:      SyslogRFC3164,
+		Hostname:    "web1",
+		ModuleField: SyslogModuleAsAppName,
+	})
+
+	writer(&buf, newSyslogTestEntry(), nil)
+
+	expected := `<12>Jan  2 03:04:05 web1 db[` + strconv.Itoa(os.Getpid()) + `]: slow query`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestSyslogConnUsesOctetCountingOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	defer listener.Close()
+
+	received := make(chan string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 64)
+		n, _ := conn.Read(buf)
+		received <- string(buf[:n])
+	}()
+
+	conn, err := DialSyslog(SyslogDialOptions{Network: "tcp", Address: listener.Addr().String()})
+	assert.Equal(t, nil, err)
+	conn.Write([]byte("hello\n"))
+	defer conn.Close()
+
+	assert.Equal(t, "5 hello", <-received)
+}
+
+func TestSyslogConnDefaultsToUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	defer listener.Close()
+
+	conn, err := DialSyslog(SyslogDialOptions{Address: listener.LocalAddr().String()})
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello\n"))
+	assert.Equal(t, nil, err)
+
+	buf := make([]byte, 64)
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := listener.ReadFrom(buf)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+}
+
+func TestSyslogConnUsesNewlinesOverUnixStreams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip("unix sockets are not supported here")
+	}
+	defer listener.Close()
+
+	received := make(chan string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 64)
+		n, _ := conn.Read(buf)
+		received <- string(buf[:n])
+	}()
+
+	// local syslog daemons do not understand octet counting
+	conn, err := DialSyslog(SyslogDialOptions{Network: "unix", Address: path})
+	assert.Equal(t, nil, err)
+	conn.Write([]byte("hello\n"))
+	defer conn.Close()
+
+	assert.Equal(t, "hello\n", <-received)
+}
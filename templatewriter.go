@@ -0,0 +1,139 @@
+// Copyright (c) 2014-present Stuart Herbert
+// Released under the 3-clause BSD license
+package modlog
+
+import (
+	"bytes"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplatePattern is the pattern used by NewTemplateOutputWriter()
+// when it is given an empty pattern
+const DefaultTemplatePattern = `{{.Time}} [{{.Level}}] {{.Module}}: {{.Message}}{{with .Fields}} {{.}}{{end}}`
+
+// TemplateEntry is what a template built by NewTemplateOutputWriter() is
+// executed against
+//
+// as well as the fields below, templates can use:
+//
+//	{{.Time}} or {{.Time "layout"}}   when the entry was created
+//	{{.Level}}                        e.g. WARNING
+//	{{.ShortLevel}}                   e.g. WARN
+//	{{.Caller}}                       e.g. main.go:12
+//	{{.Fields}}                       LogEntry.Data, as key=value pairs
+//	{{.Field "key"}}                  a single value from LogEntry.Data
+//	{{.Format "slot"}}                the output of a formatter slot
+//
+// and the functions pad, upper and lower, e.g. {{pad .Module 12}}
+type TemplateEntry struct {
+	Entry *LogEntry
+
+	// the output of each of the formatters on the output, by slot name
+	Formatted map[string]string
+
+	// copied from the LogEntry for convenience
+	Module  string
+	Message string
+}
+
+// the functions that templates can call
+var templateFuncs = template.FuncMap{
+	"pad":   padRight,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// NewTemplateOutputWriter() returns a CheckedOutputWriter that writes each log
+// entry using a text/template pattern; see TemplateEntry for what the
+// pattern can use
+//
+// a newline is added to the end of each entry if the pattern does not
+// end with one
+func NewTemplateOutputWriter(pattern string) (CheckedOutputWriter, error) {
+	if len(pattern) == 0 {
+		pattern = DefaultTemplatePattern
+	}
+
+	tmpl, err := template.New("modlog").Funcs(templateFuncs).Option("missingkey=zero").Parse(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	retval := func(out io.Writer, entry *LogEntry, data map[string]string) error {
+		buf := new(bytes.Buffer)
+		templateEntry := TemplateEntry{
+			Entry:     entry,
+			Formatted: data,
+			Module:    entry.Module,
+			Message:   entry.Message,
+		}
+		err := tmpl.Execute(buf, &templateEntry)
+		if err != nil {
+			return err
+		}
+		if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+			buf.WriteString("\n")
+		}
+
+		_, err = out.Write(buf.Bytes())
+		return err
+	}
+
+	return retval, nil
+}
+
+// Time() returns when the entry was created, formatted using the given
+// layout (or time.RFC3339 if there is no layout)
+func (self *TemplateEntry) Time(layout ...string) string {
+	if len(layout) == 0 {
+		return self.Entry.When.Format(time.RFC3339)
+	}
+
+	return self.Entry.When.Format(layout[0])
+}
+
+// Level() returns the full name of the entry's log level
+func (self *TemplateEntry) Level() string {
+	return self.Entry.LogLevel.String()
+}
+
+// ShortLevel() returns the short name of the entry's log level
+func (self *TemplateEntry) ShortLevel() string {
+	return strings.TrimSpace(self.Entry.LogLevel.ShortString())
+}
+
+// Caller() returns the file and line that created the entry, or an empty
+// string if that is not known
+func (self *TemplateEntry) Caller() string {
+	if self.Entry.Caller == nil {
+		return ""
+	}
+
+	return path.Base(self.Entry.Caller.File) + ":" + strconv.Itoa(self.Entry.Caller.Line)
+}
+
+// Fields() returns the entry's additional information as space-separated
+// key=value pairs, sorted by key
+func (self *TemplateEntry) Fields() string {
+	buf := new(bytes.Buffer)
+	for _, key := range sortedFieldKeys(self.Entry.Data) {
+		writeLogfmtPair(buf, key, logfmtValueString(self.Entry.Data[key]))
+	}
+
+	return buf.String()
+}
+
+// Field() returns a single value from the entry's additional information
+func (self *TemplateEntry) Field(key string) interface{} {
+	return self.Entry.Data[key]
+}
+
+// Format() returns the output of the named formatter slot
+func (self *TemplateEntry) Format(slot string) string {
+	return self.Formatted[slot]
+}
@@ -0,0 +1,30 @@
+package modlog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestTemplateOutputWriter(t *testing.T) {
+	var buf bytes.Buffer
+	entry := NewLogEntry(WarnLevel, "db", "slow query")
+	entry.When = time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry.Data["ms"] = 120
+	entry.Data["query"] = "select 1"
+
+	writer, err := NewTemplateOutputWriter(`{{.Time "2006-01-02T15:04:05Z07:00"}} [{{.Level}}] {{.Module}}: {{.Message}} {{.Fields}} {{.Format "prefix"}}`)
+	assert.Equal(t, nil, err)
+	err = writer(&buf, entry, map[string]string{"prefix": "app"})
+	assert.Equal(t, nil, err)
+
+	expected := `2014-01-02T03:04:05Z [WARNING] db: slow query ms=120 query="select 1" app` + "\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestTemplateOutputWriterRejectsBadPatterns(t *testing.T) {
+	_, err := NewTemplateOutputWriter(`{{.Message`)
+	assert.NotEqual(t, nil, err)
+}